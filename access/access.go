@@ -67,6 +67,11 @@ func Pull(ctx *tiny.Context) *Access {
 	return ctx.Value(keyAccess).(*Access)
 }
 
+func Lookup(ctx *tiny.Context) (*Access, bool) {
+	a, ok := ctx.Values[keyAccess].(*Access)
+	return a, ok
+}
+
 func underscore2hyphen(s string) string {
 	return http.CanonicalHeaderKey(strings.Replace(s[2:], "_", "-", -1))
 }
@@ -111,6 +116,7 @@ func New(o *Options) tiny.HandlerFunc {
 		a.Set("proto", ctx.Request.Proto)
 		a.Set("referer", ctx.Request.Referer())
 		a.Set("ua", ctx.Request.UserAgent())
+		a.Set("panic", false)
 		for _, i := range cookies {
 			if c, err := ctx.Request.Cookie(i[2:]); err == nil {
 				a.Set(i, c.Value)
@@ -121,9 +127,10 @@ func New(o *Options) tiny.HandlerFunc {
 		if o.Before != nil {
 			a.writeTo(o.Before)
 		}
-		defer func() {
-			err := recover()
-			a.Set("panic", err != nil)
+		ctx.OnFinish(func() {
+			if ctx.Panicked() {
+				a.Set("panic", true)
+			}
 			a.Set("status", ctx.Status())
 			a.Set("size", ctx.Written())
 			a.Set("duration", time.Since(t))
@@ -132,11 +139,7 @@ func New(o *Options) tiny.HandlerFunc {
 			if !a.Off && o.After != nil {
 				a.writeTo(o.After)
 			}
-			if err != nil {
-				panic(err)
-			}
-		}()
-		ctx.Next()
+		})
 	}
 }
 
@@ -0,0 +1,214 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package assets
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/cxr29/tiny"
+)
+
+type Options struct {
+	Prefix     string
+	Manifest   string // JSON object of name to hashed name in the file system, hash at startup if empty
+	Redirect   bool   // redirect unhashed or stale names to the current URL, otherwise 404
+	HashLength int
+}
+
+var (
+	DefaultOptions = &Options{
+		Prefix:     "/static",
+		HashLength: 8,
+	}
+	Default *Assets // the first created unless set
+)
+
+type Assets struct {
+	fsys  fs.FS
+	o     *Options
+	dev   bool
+	names map[string]string // name to hashed name
+	files map[string]string // hashed name to file
+	stale *regexp.Regexp
+}
+
+func New(fsys fs.FS, o *Options) *Assets {
+	if o == nil {
+		o = DefaultOptions
+	}
+	if o.HashLength <= 0 || o.HashLength > sha256.Size*2 {
+		panic("malformed hash length")
+	}
+	a := &Assets{
+		fsys:  fsys,
+		o:     o,
+		dev:   tiny.Dev(),
+		names: make(map[string]string),
+		files: make(map[string]string),
+		stale: regexp.MustCompile(`^(.*)\.[0-9a-f]{` + strconv.Itoa(o.HashLength) + `}(\.[^./]+)?$`),
+	}
+	if !a.dev {
+		var err error
+		if o.Manifest != "" {
+			err = a.readManifest()
+		} else {
+			err = a.hashFiles()
+		}
+		if err != nil {
+			panic(err)
+		}
+	}
+	if Default == nil {
+		Default = a
+	}
+	return a
+}
+
+func (a *Assets) readManifest() error {
+	p, err := fs.ReadFile(a.fsys, a.o.Manifest)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(p, &a.names); err != nil {
+		return err
+	}
+	for name, hashed := range a.names {
+		if !fs.ValidPath(name) || !fs.ValidPath(hashed) {
+			return errors.New("malformed manifest entry: " + name)
+		}
+		a.files[hashed] = hashed
+	}
+	return nil
+}
+
+func (a *Assets) hashFiles() error {
+	return fs.WalkDir(a.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && name != "." {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		p, err := fs.ReadFile(a.fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(p)
+		hashed := hashedName(name, hex.EncodeToString(sum[:])[:a.o.HashLength])
+		a.names[name] = hashed
+		a.files[hashed] = name
+		return nil
+	})
+}
+
+func hashedName(name, hash string) string {
+	ext := path.Ext(name)
+	if strings.ContainsRune(ext, '/') {
+		ext = ""
+	}
+	return name[:len(name)-len(ext)] + "." + hash + ext
+}
+
+func (a *Assets) URL(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if hashed, ok := a.names[name]; ok {
+		name = hashed
+	}
+	return a.o.Prefix + "/" + name
+}
+
+// with the first Assets created
+func URL(name string) string {
+	if Default == nil {
+		panic("no assets")
+	}
+	return Default.URL(name)
+}
+
+func (a *Assets) Register(r *tiny.Router) {
+	p := a.o.Prefix + "/<path:str>"
+	r.GET(p, a)
+	r.HEAD(p, a)
+}
+
+func (a *Assets) ServeHTTP(ctx *tiny.Context) {
+	name := ctx.Param("path")
+	if name == "" || !fs.ValidPath(name) || strings.HasPrefix(name, ".") || strings.Contains(name, "/.") {
+		ctx.NotFound()
+		return
+	}
+	if a.dev {
+		ctx.NoCache()
+		a.serve(ctx, name, name)
+		return
+	}
+	if file, ok := a.files[name]; ok {
+		ctx.MaxAge(365 * 24 * 60 * 60)
+		ctx.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		a.serve(ctx, name, file)
+		return
+	}
+	if a.o.Redirect {
+		current, ok := a.names[name]
+		if !ok {
+			if m := a.stale.FindStringSubmatch(name); m != nil {
+				current, ok = a.names[m[1]+m[2]]
+			}
+		}
+		if ok {
+			ctx.Header().Set("Cache-Control", "no-cache")
+			ctx.Found(strings.TrimSuffix(ctx.Request.URL.Path, name) + current)
+			return
+		}
+	}
+	ctx.NotFound()
+}
+
+func (a *Assets) serve(ctx *tiny.Context, name, file string) {
+	f, err := a.fsys.Open(file)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			ctx.NotFound()
+		} else {
+			ctx.Error(err)
+		}
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		ctx.Error(err)
+		return
+	} else if fi.IsDir() {
+		ctx.NotFound()
+		return
+	}
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		p, err := io.ReadAll(f)
+		if err != nil {
+			ctx.Error(err)
+			return
+		}
+		rs = bytes.NewReader(p)
+	}
+	ctx.ServeContent(path.Base(name), fi.ModTime(), rs)
+}
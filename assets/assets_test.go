@@ -0,0 +1,72 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package assets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/cxr29/tiny"
+)
+
+func TestAssets(t *testing.T) {
+	mod := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"app.js":       {Data: []byte("js"), ModTime: mod},
+		"css/site.css": {Data: []byte("css"), ModTime: mod},
+		".git/x":       {Data: []byte("x")},
+	}
+	a := New(fsys, &Options{Prefix: "/static", Redirect: true, HashLength: 6})
+	if Default != a {
+		t.Fatal("Default not set")
+	}
+	js, css := a.URL("app.js"), a.URL("/css/site.css")
+	if js == "/static/app.js" || a.URL("nope.js") != "/static/nope.js" {
+		t.Fatalf("URL: %s %s", js, a.URL("nope.js"))
+	}
+	r := new(tiny.Router)
+	r.Group("/v1", func(r *tiny.Router) {
+		a.Register(r)
+	})
+	h := r.Handler()
+	for _, c := range []struct {
+		path, ims string
+		status    int
+		body      string
+		location  string
+	}{
+		{"/v1" + js, "", http.StatusOK, "js", ""},
+		{"/v1" + css, "", http.StatusOK, "css", ""},
+		{"/v1" + js, mod.Format(http.TimeFormat), http.StatusNotModified, "", ""},
+		{"/v1" + js, mod.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK, "js", ""},
+		{"/v1/static/app.js", "", http.StatusFound, "", "/v1" + js},
+		{"/v1/static/app.abcdef.js", "", http.StatusFound, "", "/v1" + js},
+		{"/v1/static/.git/x", "", http.StatusNotFound, "", ""},
+		{"/v1/static/nope.js", "", http.StatusNotFound, "", ""},
+	} {
+		req := httptest.NewRequest("GET", c.path, nil)
+		if c.ims != "" {
+			req.Header.Set("If-Modified-Since", c.ims)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != c.status {
+			t.Errorf("%s: status %d, want %d", c.path, w.Code, c.status)
+			continue
+		}
+		if c.body != "" && w.Body.String() != c.body {
+			t.Errorf("%s: got %q, want %q", c.path, w.Body, c.body)
+		}
+		if loc := w.Header().Get("Location"); loc != c.location {
+			t.Errorf("%s: location %q, want %q", c.path, loc, c.location)
+		}
+		if c.status == http.StatusOK && w.Header().Get("Last-Modified") != mod.Format(http.TimeFormat) {
+			t.Errorf("%s: Last-Modified %q", c.path, w.Header().Get("Last-Modified"))
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"io"
+)
+
+const (
+	mimeMsgPack = "application/msgpack"
+	mimeCBOR    = "application/cbor"
+)
+
+// for binary formats such as msgpack and cbor, which register themselves
+func BinaryEncoder(marshal func(interface{}) ([]byte, error)) Encoder {
+	return func(w io.Writer, v interface{}) error {
+		p, err := marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(p)
+		return err
+	}
+}
+
+// the body is read whole, unmarshal returns a DecodeError for malformed data
+func BinaryDecoder(unmarshal func([]byte, interface{}) error) Decoder {
+	return func(r io.Reader, v interface{}) error {
+		p, err := io.ReadAll(r)
+		if err != nil {
+			return decodeError(err)
+		}
+		if len(p) == 0 {
+			return badRequest("", ErrEmptyBody)
+		}
+		return unmarshal(p, v)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/cxr29/tiny/validate"
+)
+
+var bindSources = [...]string{"path", "query", "header", "cookie", "form"}
+
+type FieldError struct {
+	Source, Name, Value string
+	Err                 error
+}
+
+func (e *FieldError) Error() string {
+	return e.Source + " " + e.Name + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+func (e *FieldError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{
+		"source": e.Source,
+		"name":   e.Name,
+		"value":  e.Value,
+		"error":  e.Err.Error(),
+	})
+}
+
+func (e *FieldError) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	return enc.EncodeElement(struct {
+		Source string `xml:"source"`
+		Name   string `xml:"name"`
+		Value  string `xml:"value"`
+		Error  string `xml:"error"`
+	}{e.Source, e.Name, e.Value, e.Err.Error()}, start)
+}
+
+type BindErrors []*FieldError
+
+func (a BindErrors) Error() string {
+	s := make([]string, len(a))
+	for i, e := range a {
+		s[i] = e.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+func (a BindErrors) Unwrap() []error {
+	errs := make([]error, len(a))
+	for i, e := range a {
+		errs[i] = e
+	}
+	return errs
+}
+
+func (a BindErrors) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+type binder struct {
+	ctx    *Context
+	query  url.Values
+	parsed bool
+	err    error
+	errs   BindErrors
+}
+
+func (ctx *Context) Bind(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("tiny: Bind(non-pointer to struct %T)", v)
+	}
+	b := &binder{ctx: ctx}
+	b.bindStruct(rv.Elem())
+	if b.err != nil {
+		return b.err
+	} else if len(b.errs) > 0 {
+		return b.errs
+	}
+	return validate.Struct(v)
+}
+
+func (b *binder) lookup(source, name string) (a []string) {
+	r := b.ctx.Request
+	switch source {
+	case "path":
+		if s := b.ctx.Param(name); s != "" {
+			a = []string{s}
+		}
+	case "query":
+		if b.query == nil {
+			b.query = r.URL.Query()
+		}
+		a = b.query[name]
+	case "header":
+		a = r.Header.Values(name)
+	case "cookie":
+		for _, c := range r.Cookies() {
+			if c.Name == name {
+				a = append(a, c.Value)
+			}
+		}
+	case "form":
+		if !b.parsed {
+			b.parsed = true
+			if err := b.parseForm(); err != nil {
+				b.errs = append(b.errs, &FieldError{source, name, "", err})
+				return
+			}
+		}
+		a = r.PostForm[name]
+	}
+	return
+}
+
+func (b *binder) parseForm() error {
+	r := b.ctx.Request
+	o := DefaultDecodeOptions
+	if o.MaxBodySize > 0 {
+		r.Body = http.MaxBytesReader(b.ctx, r.Body, o.MaxBodySize)
+	}
+	t, _, _ := mime.ParseMediaType(r.Header.Get(contentType))
+	if t == mimeMultipart {
+		return r.ParseMultipartForm(o.MaxMemory)
+	}
+	return r.ParseForm()
+}
+
+func isLeaf(t reflect.Type) bool {
+	return t == typeTime || reflect.PtrTo(t).Implements(typeTextUnmarshaler)
+}
+
+// struct type to the error of its malformed default tag, nil if none
+var checkedDefaults sync.Map
+
+func checkDefaults(rt reflect.Type) error {
+	if v, ok := checkedDefaults.Load(rt); ok {
+		err, _ := v.(error)
+		return err
+	}
+	var err error
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		s, ok := f.Tag.Lookup("default")
+		if !ok || !bindTagged(f) {
+			continue
+		}
+		if e := setDefault(reflect.New(f.Type).Elem(), s, f.Tag.Get("layout")); e != nil {
+			err = fmt.Errorf("tiny: malformed default of %s.%s: %w", rt, f.Name, e)
+			break
+		}
+	}
+	checkedDefaults.Store(rt, err)
+	return err
+}
+
+func bindTagged(f reflect.StructField) bool {
+	for _, source := range bindSources {
+		if name, ok := f.Tag.Lookup(source); ok && name != "-" {
+			return true
+		}
+	}
+	return false
+}
+
+func setDefault(fv reflect.Value, s, layout string) error {
+	a := []string{s}
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+		a = strings.Split(s, ",")
+	}
+	return setValues(fv, a, layout)
+}
+
+func (b *binder) bindStruct(rv reflect.Value) (n int) {
+	rt := rv.Type()
+	if err := checkDefaults(rt); err != nil {
+		if b.err == nil {
+			b.err = err
+		}
+		return
+	}
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		fv := rv.Field(i)
+		if tagged, found := b.bindField(f, fv); found {
+			n++
+			continue
+		} else if tagged {
+			continue
+		}
+		switch t := f.Type; {
+		case t.Kind() == reflect.Struct && !isLeaf(t):
+			n += b.bindStruct(fv)
+		case t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct && !isLeaf(t.Elem()):
+			v := fv
+			if v.IsNil() {
+				v = reflect.New(t.Elem())
+			}
+			if i := b.bindStruct(v.Elem()); i > 0 {
+				fv.Set(v)
+				n += i
+			}
+		}
+	}
+	return
+}
+
+func (b *binder) bindField(f reflect.StructField, fv reflect.Value) (tagged, found bool) {
+	layout := f.Tag.Get("layout")
+	for _, source := range bindSources {
+		name, ok := f.Tag.Lookup(source)
+		if !ok || name == "-" {
+			continue
+		}
+		tagged = true
+		if a := b.lookup(source, name); len(a) > 0 {
+			if err := setValues(fv, a, layout); err != nil {
+				b.errs = append(b.errs, &FieldError{source, name, a[0], err})
+			}
+			return true, true
+		}
+	}
+	if s, ok := f.Tag.Lookup("default"); ok && tagged {
+		setDefault(fv, s, layout) // checked by checkDefaults
+	}
+	return
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cxr29/tiny/validate"
+)
+
+type bindPage struct {
+	Num  int `query:"page" default:"1"`
+	Size int `query:"size" default:"20" validate:"max=100"`
+}
+
+type bindItem struct {
+	ID     int           `path:"id"`
+	Tags   []string      `query:"tag" default:"a,b"`
+	Tenant string        `header:"X-Tenant"`
+	SID    string        `cookie:"sid"`
+	Since  time.Time     `query:"since" layout:"2006-01-02"`
+	TTL    time.Duration `query:"ttl" default:"5s"`
+	Name   string        `form:"name"`
+	bindPage
+}
+
+func serveBind(target string, header map[string]string, body string, v interface{}) error {
+	var err error
+	r := new(Router)
+	r.POST("/items/<id:int>", func(ctx *Context) {
+		err = ctx.Bind(v)
+	})
+	req := httptest.NewRequest("POST", target, strings.NewReader(body))
+	for k, s := range header {
+		req.Header.Set(k, s)
+	}
+	r.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	return err
+}
+
+func TestBind(t *testing.T) {
+	var v bindItem
+	err := serveBind("/items/42?since=2020-01-02&size=5", map[string]string{
+		"X-Tenant":     "acme",
+		"Cookie":       "sid=abc",
+		"Content-Type": "application/x-www-form-urlencoded",
+	}, "name=x", &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bindItem{
+		ID:       42,
+		Tags:     []string{"a", "b"},
+		Tenant:   "acme",
+		SID:      "abc",
+		Since:    time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+		TTL:      5 * time.Second,
+		Name:     "x",
+		bindPage: bindPage{1, 5},
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("got %+v, want %+v", v, want)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	var v bindItem
+	err := serveBind("/items/1?page=x&ttl=y", nil, "", &v)
+	var be BindErrors
+	if !errors.As(err, &be) || len(be) != 2 {
+		t.Fatalf("got %v, want 2 bind errors", err)
+	}
+	if e := be[0]; e.Source != "query" || e.Name != "ttl" || e.Value != "y" {
+		t.Errorf("got %+v", e)
+	}
+	if be.StatusCode() != 400 {
+		t.Errorf("status %d", be.StatusCode())
+	}
+
+	err = serveBind("/items/1?size=101", nil, "", &v)
+	var ve validate.Errors
+	if !errors.As(err, &ve) {
+		t.Errorf("got %v, want validation errors", err)
+	}
+
+	if err = serveBind("/items/1", nil, "", v); err == nil {
+		t.Error("non-pointer bound")
+	}
+}
+
+func TestBindMalformedDefault(t *testing.T) {
+	type item struct {
+		N int `query:"n" default:"x"`
+	}
+	var v item
+	for i := 0; i < 2; i++ {
+		err := serveBind("/items/1?n=1", nil, "", &v)
+		if err == nil || !strings.Contains(err.Error(), "malformed default of tiny.item.N") {
+			t.Errorf("got %v", err)
+		}
+	}
+	if v.N != 0 {
+		t.Errorf("bound %d", v.N)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+
+	"github.com/cxr29/log"
+)
+
+type Buffer struct {
+	http.ResponseWriter
+	ctx     *Context
+	limit   int
+	buf     bytes.Buffer
+	code    int
+	header  http.Header
+	spilled bool
+}
+
+func NewBuffer(limit int) Handler {
+	return HandlerFunc(func(ctx *Context) {
+		ctx.Buffer(limit)
+	})
+}
+
+func (ctx *Context) Buffer(limit int) *Buffer {
+	if ctx.buffer != nil {
+		return ctx.buffer
+	}
+	if ctx.wroteHeader {
+		panic("buffer after header written")
+	}
+	b := &Buffer{
+		ResponseWriter: ctx.ResponseWriter,
+		ctx:            ctx,
+		limit:          limit,
+		header:         ctx.Header().Clone(),
+	}
+	ctx.ResponseWriter = b
+	ctx.buffer = b
+	ctx.OnFinish(func() {
+		if !ctx.Panicked() {
+			b.flush()
+		}
+	})
+	return b
+}
+
+func (ctx *Context) Buffered() *Buffer {
+	return ctx.buffer
+}
+
+func (ctx *Context) resetBuffer() bool {
+	return ctx.buffer != nil && ctx.buffer.Reset()
+}
+
+func (b *Buffer) WriteHeader(code int) {
+	if b.spilled {
+		b.ResponseWriter.WriteHeader(code)
+	} else if b.code == 0 {
+		b.code = code
+	}
+}
+
+func (b *Buffer) Write(data []byte) (int, error) {
+	if !b.spilled {
+		if b.limit <= 0 || b.buf.Len()+len(data) <= b.limit {
+			return b.buf.Write(data)
+		}
+		if err := b.spill(); err != nil {
+			return 0, err
+		}
+	}
+	return b.ResponseWriter.Write(data)
+}
+
+func (b *Buffer) spill() error {
+	b.spilled = true
+	if b.code == 0 {
+		b.code = http.StatusOK
+	}
+	b.ResponseWriter.WriteHeader(b.code)
+	if b.buf.Len() == 0 {
+		return nil
+	}
+	_, err := b.ResponseWriter.Write(b.buf.Bytes())
+	b.buf = bytes.Buffer{}
+	return err
+}
+
+func bodyAllowed(code int) bool {
+	return !(code >= 100 && code <= 199 || code == http.StatusNoContent || code == http.StatusNotModified)
+}
+
+func (b *Buffer) flush() {
+	if b.spilled || (b.code == 0 && b.buf.Len() == 0) {
+		return
+	}
+	if b.code == 0 {
+		b.code = http.StatusOK
+	}
+	h := b.Header()
+	if bodyAllowed(b.code) && b.ctx.Request.Method != "HEAD" &&
+		h.Get("Transfer-Encoding") == "" && h.Get("Content-Length") == "" {
+		h.Set("Content-Length", strconv.Itoa(b.buf.Len()))
+	}
+	log.ErrWarning(b.spill())
+}
+
+func (b *Buffer) Flush() {
+	if !b.spilled {
+		log.ErrWarning(b.spill())
+	}
+	if f, ok := b.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (b *Buffer) Reset() bool {
+	if b.spilled {
+		return false
+	}
+	b.buf.Reset()
+	b.code = 0
+	h := b.Header()
+	for k := range h {
+		delete(h, k)
+	}
+	for k, v := range b.header {
+		h[k] = append([]string(nil), v...)
+	}
+	b.ctx.wroteHeader = false
+	b.ctx.status = 0
+	b.ctx.written = 0
+	return true
+}
+
+func (b *Buffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+func (b *Buffer) Len() int {
+	return b.buf.Len()
+}
+
+func (b *Buffer) Spilled() bool {
+	return b.spilled
+}
+
+// a buffered response, kept to be replayed
+type Response struct {
+	Status int
+	Header http.Header // changed since buffering
+	Body   []byte
+}
+
+func (b *Buffer) Response() *Response {
+	res := &Response{
+		Status: b.code,
+		Header: make(http.Header),
+		Body:   append([]byte(nil), b.buf.Bytes()...),
+	}
+	if res.Status == 0 {
+		res.Status = http.StatusOK
+	}
+	for k, v := range b.Header() {
+		if !equal(b.header[k], v) {
+			res.Header[k] = append([]string(nil), v...)
+		}
+	}
+	return res
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (ctx *Context) ReplayHeader(res *Response) {
+	h := ctx.Header()
+	for k, v := range res.Header {
+		h[k] = append([]string(nil), v...)
+	}
+}
+
+func (ctx *Context) Replay(res *Response) {
+	ctx.ReplayHeader(res)
+	h := ctx.Header()
+	if bodyAllowed(res.Status) && h.Get("Transfer-Encoding") == "" {
+		h.Set("Content-Length", strconv.Itoa(len(res.Body)))
+	}
+	ctx.WriteHeader(res.Status)
+	if ctx.Request.Method != "HEAD" && len(res.Body) > 0 {
+		ctx.Write(res.Body)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func serveBuffer(method string, limit int, f func(ctx *Context, b *Buffer)) *httptest.ResponseRecorder {
+	r := new(Router)
+	r.Use(func(ctx *Context) {
+		ctx.Header().Set("X-Before", "1")
+	}, NewBuffer(limit))
+	r.Handle(method, "/", func(ctx *Context) {
+		f(ctx, ctx.Buffered())
+	})
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest(method, "/", nil))
+	return w
+}
+
+func TestBuffer(t *testing.T) {
+	w := serveBuffer("GET", 8, func(ctx *Context, b *Buffer) {
+		ctx.WriteString("abc")
+		if ctx.Written() != 3 || b.Len() != 3 {
+			t.Errorf("written %d, buffered %d", ctx.Written(), b.Len())
+		}
+	})
+	if w.Code != 200 || w.Body.String() != "abc" || w.Header().Get("Content-Length") != "3" {
+		t.Errorf("got %d %q %v", w.Code, w.Body, w.Header())
+	}
+
+	w = serveBuffer("HEAD", 8, func(ctx *Context, b *Buffer) {
+		ctx.WriteHeader(204)
+	})
+	if w.Code != 204 || w.Header().Get("Content-Length") != "" {
+		t.Errorf("got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestBufferReset(t *testing.T) {
+	w := serveBuffer("GET", 8, func(ctx *Context, b *Buffer) {
+		ctx.Header().Set("X-Partial", "1")
+		ctx.Header().Set("X-Before", "2")
+		ctx.WriteHeader(201)
+		ctx.WriteString("part")
+		if !b.Reset() {
+			t.Error("not reset")
+		}
+		if ctx.WroteHeader() || ctx.Status() != 0 || ctx.Written() != 0 {
+			t.Errorf("context not reset: %v %d %d", ctx.WroteHeader(), ctx.Status(), ctx.Written())
+		}
+		ctx.WriteHeader(202)
+		ctx.WriteString("full")
+	})
+	if w.Code != 202 || w.Body.String() != "full" {
+		t.Errorf("got %d %q", w.Code, w.Body)
+	}
+	if w.Header().Get("X-Partial") != "" || w.Header().Get("X-Before") != "1" {
+		t.Errorf("header not restored: %v", w.Header())
+	}
+}
+
+func TestBufferSpill(t *testing.T) {
+	w := serveBuffer("GET", 4, func(ctx *Context, b *Buffer) {
+		ctx.WriteHeader(201)
+		ctx.WriteString("abc")
+		ctx.WriteString("defg")
+		if !b.Spilled() || b.Reset() {
+			t.Errorf("spilled %v", b.Spilled())
+		}
+		ctx.WriteString("h")
+	})
+	if w.Code != 201 || w.Body.String() != "abcdefgh" || w.Header().Get("Content-Length") != "" {
+		t.Errorf("got %d %q %v", w.Code, w.Body, w.Header())
+	}
+
+	w = serveBuffer("GET", 0, func(ctx *Context, b *Buffer) {
+		ctx.WriteString("unlimited")
+		if b.Spilled() {
+			t.Error("spilled without a limit")
+		}
+	})
+	if w.Body.String() != "unlimited" {
+		t.Errorf("got %q", w.Body)
+	}
+}
+
+func TestBufferResponse(t *testing.T) {
+	var res *Response
+	serveBuffer("GET", 8, func(ctx *Context, b *Buffer) {
+		ctx.Header().Set("X-After", "1")
+		ctx.WriteString("abc")
+		res = b.Response()
+	})
+	if res.Status != 200 || string(res.Body) != "abc" ||
+		res.Header.Get("X-Before") != "" || res.Header.Get("X-After") != "1" {
+		t.Fatalf("got %+v", res)
+	}
+	for _, method := range []string{"GET", "HEAD"} {
+		w := serveBuffer(method, 0, func(ctx *Context, b *Buffer) {
+			ctx.Replay(res)
+		})
+		body := "abc"
+		if method == "HEAD" {
+			body = ""
+		}
+		if w.Code != 200 || w.Body.String() != body || w.Header().Get("X-After") != "1" ||
+			w.Header().Get("Content-Length") != "3" {
+			t.Errorf("%s: got %d %q %v", method, w.Code, w.Body, w.Header())
+		}
+	}
+}
@@ -0,0 +1,391 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cxr29/tiny"
+)
+
+type Options struct {
+	MaxBytes   int64         // total size of the cached responses
+	MaxEntry   int           // responses larger are streamed and not cached
+	DefaultTTL time.Duration // for responses without max-age, not cached if zero
+}
+
+var (
+	DefaultOptions = &Options{
+		MaxBytes: 64 << 20,
+		MaxEntry: 1 << 20,
+	}
+	keyTags = tiny.NewValueKey()
+)
+
+type refreshKey struct{}
+
+// tag the response for PurgeTag
+func Tag(ctx *tiny.Context, tags ...string) {
+	if p, ok := ctx.Values[keyTags].(*[]string); ok {
+		*p = append(*p, tags...)
+	} else {
+		ctx.SetValue(keyTags, &tags)
+	}
+}
+
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+type entry struct {
+	key, base  string
+	res        *tiny.Response
+	stored     time.Time
+	ttl        time.Duration
+	swr, sie   time.Duration // stale-while-revalidate, stale-if-error
+	route      string
+	tags       []string
+	refreshing bool
+}
+
+func (e *entry) size() int64 {
+	n := len(e.key) + len(e.res.Body)
+	for k, v := range e.res.Header {
+		n += len(k)
+		for _, s := range v {
+			n += len(s)
+		}
+	}
+	return int64(n)
+}
+
+func (e *entry) age(now time.Time) time.Duration {
+	return now.Sub(e.stored)
+}
+
+type variant struct {
+	names []string // vary header names
+	n     int      // entries
+}
+
+type Cache struct {
+	o        *Options
+	mu       sync.Mutex
+	lru      list.List
+	entries  map[string]*list.Element
+	variants map[string]*variant // by base key
+	bytes    int64
+}
+
+func New(o *Options) *Cache {
+	if o == nil {
+		o = DefaultOptions
+	}
+	return &Cache{
+		o:        o,
+		entries:  make(map[string]*list.Element),
+		variants: make(map[string]*variant),
+	}
+}
+
+func baseKey(r *http.Request) string {
+	return "GET " + r.URL.Path + "?" + r.URL.RawQuery
+}
+
+func variantKey(base string, names []string, r *http.Request) string {
+	if len(names) == 0 {
+		return base
+	}
+	var b strings.Builder
+	b.WriteString(base)
+	for _, k := range names {
+		b.WriteString("\n")
+		b.WriteString(k)
+		b.WriteString(": ")
+		b.WriteString(strings.Join(r.Header.Values(k), ", "))
+	}
+	return b.String()
+}
+
+func varyNames(h http.Header) (a []string, ok bool) {
+	for _, v := range h.Values("Vary") {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s == "*" {
+				return nil, false
+			} else if s != "" {
+				a = append(a, http.CanonicalHeaderKey(s))
+			}
+		}
+	}
+	sort.Strings(a)
+	return a, true
+}
+
+type directives map[string]string
+
+func parseCacheControl(s string) directives {
+	d := make(directives, 4)
+	for _, i := range strings.Split(s, ",") {
+		i = strings.TrimSpace(i)
+		if i == "" {
+			continue
+		}
+		k, v := i, ""
+		if j := strings.IndexByte(i, '='); j >= 0 {
+			k, v = i[:j], strings.Trim(i[j+1:], `"`)
+		}
+		d[strings.ToLower(k)] = v
+	}
+	return d
+}
+
+func (d directives) has(k string) bool {
+	_, ok := d[k]
+	return ok
+}
+
+func (d directives) seconds(k string) (time.Duration, bool) {
+	v, ok := d[k]
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil || i < 0 {
+		return 0, false
+	}
+	return time.Duration(i) * time.Second, true
+}
+
+func (c *Cache) lookup(r *http.Request) *entry {
+	base := baseKey(r)
+	v, ok := c.variants[base]
+	if !ok {
+		return nil
+	}
+	if el, ok := c.entries[variantKey(base, v.names, r)]; ok {
+		c.lru.MoveToFront(el)
+		return el.Value.(*entry)
+	}
+	return nil
+}
+
+func (c *Cache) ServeHTTP(ctx *tiny.Context) {
+	r := ctx.Request
+	if r.Method != "GET" && r.Method != "HEAD" || r.Header.Get("Authorization") != "" {
+		return
+	}
+	rc := parseCacheControl(r.Header.Get("Cache-Control"))
+	if rc.has("no-store") {
+		return
+	}
+	var stale *entry
+	if r.Context().Value(refreshKey{}) == nil && !rc.has("no-cache") {
+		now := time.Now()
+		c.mu.Lock()
+		e := c.lookup(r)
+		var refresh bool
+		if e != nil {
+			age := e.age(now)
+			switch {
+			case age < e.ttl:
+			case age < e.ttl+e.swr:
+				if !e.refreshing {
+					e.refreshing, refresh = true, true
+				}
+			case age < e.ttl+e.sie:
+				stale, e = e, nil
+			default:
+				e = nil
+			}
+		}
+		c.mu.Unlock()
+		if e != nil {
+			if refresh {
+				c.refresh(ctx, e)
+			}
+			serve(ctx, e, now)
+			return
+		}
+	}
+	b := ctx.Buffer(c.o.MaxEntry)
+	ctx.OnFinish(func() {
+		if ctx.Panicked() || b.Spilled() {
+			return
+		}
+		if stale != nil && ctx.Status() >= 500 && b.Reset() {
+			serve(ctx, stale, time.Now())
+			return
+		}
+		if r.Method == "GET" {
+			c.store(ctx, b)
+		}
+	})
+}
+
+func (c *Cache) refresh(ctx *tiny.Context, e *entry) {
+	r := ctx.Request.Clone(context.WithValue(context.Background(), refreshKey{}, true))
+	r.Method = "GET"
+	t := ctx.Tree()
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			e.refreshing = false
+			c.mu.Unlock()
+		}()
+		t.ServeHTTP(&discard{header: make(http.Header)}, r)
+	}()
+}
+
+type discard struct {
+	header http.Header
+}
+
+func (w *discard) Header() http.Header {
+	return w.header
+}
+
+func (w *discard) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (w *discard) WriteHeader(int) {}
+
+func serve(ctx *tiny.Context, e *entry, now time.Time) {
+	ctx.ReplayHeader(e.res)
+	h := ctx.Header()
+	h.Set("Age", strconv.FormatInt(int64(e.age(now)/time.Second), 10))
+	modTime, _ := http.ParseTime(h.Get("Last-Modified"))
+	if e.res.Status == http.StatusOK && !ctx.CheckPreconditions(h.Get("ETag"), modTime) {
+		return
+	}
+	ctx.Replay(e.res)
+}
+
+func (c *Cache) store(ctx *tiny.Context, b *tiny.Buffer) {
+	if ctx.Status() == 0 && b.Len() == 0 {
+		return
+	}
+	res := b.Response()
+	h := ctx.Header()
+	if !cacheableStatus[res.Status] || h.Get("Set-Cookie") != "" {
+		return
+	}
+	d := parseCacheControl(h.Get("Cache-Control"))
+	if d.has("no-store") || d.has("private") || d.has("no-cache") {
+		return
+	}
+	ttl, ok := d.seconds("s-maxage")
+	if !ok {
+		ttl, ok = d.seconds("max-age")
+	}
+	if !ok {
+		ttl = c.o.DefaultTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	names, ok := varyNames(h)
+	if !ok {
+		return
+	}
+	e := &entry{
+		res:    res,
+		stored: time.Now(),
+		ttl:    ttl,
+		route:  ctx.RouteName(),
+	}
+	e.swr, _ = d.seconds("stale-while-revalidate")
+	e.sie, _ = d.seconds("stale-if-error")
+	if p, ok := ctx.Values[keyTags].(*[]string); ok {
+		e.tags = *p
+	}
+	for _, k := range [...]string{"Age", "Connection", "Content-Length", "Keep-Alive", "Trailer", "Transfer-Encoding"} {
+		delete(res.Header, k)
+	}
+	e.base = baseKey(ctx.Request)
+	e.key = variantKey(e.base, names, ctx.Request)
+	if e.size() > c.o.MaxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[e.key]; ok {
+		c.remove(el)
+	}
+	v, ok := c.variants[e.base]
+	if !ok {
+		v = new(variant)
+		c.variants[e.base] = v
+	}
+	v.names = names
+	v.n++
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.bytes += e.size()
+	for c.bytes > c.o.MaxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *Cache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*entry)
+	delete(c.entries, e.key)
+	c.bytes -= e.size()
+	if v := c.variants[e.base]; v != nil {
+		if v.n--; v.n <= 0 {
+			delete(c.variants, e.base)
+		}
+	}
+}
+
+func (c *Cache) purge(f func(*entry) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		if f(el.Value.(*entry)) {
+			c.remove(el)
+		}
+		el = next
+	}
+}
+
+func (c *Cache) PurgeRoute(name string) {
+	c.purge(func(e *entry) bool {
+		return e.route == name
+	})
+}
+
+func (c *Cache) PurgeTag(tag string) {
+	c.purge(func(e *entry) bool {
+		for _, s := range e.tags {
+			if s == tag {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (c *Cache) Purge() {
+	c.purge(func(*entry) bool {
+		return true
+	})
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/cxr29/tiny"
+)
+
+func do(h http.Handler, method, target string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func newServer(c *Cache) (http.Handler, *int) {
+	n := new(int)
+	r := new(tiny.Router)
+	r.Use(c)
+	r.GET("/items", func(ctx *tiny.Context) {
+		*n++
+		Tag(ctx, "items")
+		ctx.Vary("Accept-Language")
+		ctx.Header().Set("Cache-Control", "max-age=60")
+		ctx.Header().Set("ETag", `"`+ctx.Request.Header.Get("Accept-Language")+`"`)
+		ctx.WriteString(ctx.Request.Header.Get("Accept-Language") + " " + strconv.Itoa(*n))
+	})
+	r.GET("/private", func(ctx *tiny.Context) {
+		*n++
+		ctx.Header().Set("Cache-Control", "private, max-age=60")
+		ctx.WriteString(strconv.Itoa(*n))
+	})
+	r.GET("/any", func(ctx *tiny.Context) {
+		*n++
+		ctx.Header().Set("Cache-Control", "max-age=60")
+		ctx.Header().Set("Vary", "*")
+		ctx.WriteString(strconv.Itoa(*n))
+	})
+	return r.Handler(), n
+}
+
+func TestVariants(t *testing.T) {
+	c := New(nil)
+	h, n := newServer(c)
+	for _, x := range []struct {
+		method, lang, body string
+		cached             bool
+	}{
+		{"GET", "en", "en 1", false},
+		{"GET", "en", "en 1", true},
+		{"GET", "fr", "fr 2", false},
+		{"GET", "fr", "fr 2", true},
+		{"HEAD", "en", "", true},
+		{"GET", "en", "en 1", true},
+	} {
+		w := do(h, x.method, "/items", "Accept-Language", x.lang)
+		if w.Code != 200 || w.Body.String() != x.body {
+			t.Errorf("%s %s: got %d %q, want %q", x.method, x.lang, w.Code, w.Body, x.body)
+		}
+		if cached := w.Header().Get("Age") != ""; cached != x.cached {
+			t.Errorf("%s %s: cached %v", x.method, x.lang, cached)
+		}
+		if w.Header().Get("Content-Length") != "4" || w.Header().Get("Vary") != "Accept-Language" {
+			t.Errorf("%s %s: header %v", x.method, x.lang, w.Header())
+		}
+	}
+	if *n != 2 {
+		t.Errorf("ran %d times", *n)
+	}
+
+	// revalidated against the cached validators
+	w := do(h, "GET", "/items", "Accept-Language", "en", "If-None-Match", `"en"`)
+	if w.Code != 304 || w.Body.Len() != 0 {
+		t.Errorf("got %d %q", w.Code, w.Body)
+	}
+	// bypassed
+	do(h, "GET", "/items", "Accept-Language", "en", "Authorization", "Bearer x")
+	do(h, "GET", "/items", "Accept-Language", "en", "Cache-Control", "no-cache")
+	if *n != 4 {
+		t.Errorf("ran %d times", *n)
+	}
+
+	c.PurgeTag("items")
+	if w = do(h, "GET", "/items", "Accept-Language", "fr"); w.Header().Get("Age") != "" || *n != 5 {
+		t.Errorf("not purged: %q, ran %d times", w.Body, *n)
+	}
+}
+
+func TestNotStored(t *testing.T) {
+	h, n := newServer(New(nil))
+	for _, path := range []string{"/private", "/any"} {
+		do(h, "GET", path)
+		if w := do(h, "GET", path); w.Header().Get("Age") != "" {
+			t.Errorf("%s: cached", path)
+		}
+	}
+	if *n != 4 {
+		t.Errorf("ran %d times", *n)
+	}
+}
+
+func TestMaxEntry(t *testing.T) {
+	h, n := newServer(New(&Options{MaxBytes: 1 << 10, MaxEntry: 2}))
+	do(h, "GET", "/items", "Accept-Language", "en")
+	if w := do(h, "GET", "/items", "Accept-Language", "en"); w.Body.String() != "en 2" || *n != 2 {
+		t.Errorf("got %q, ran %d times", w.Body, *n)
+	}
+}
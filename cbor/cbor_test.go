@@ -0,0 +1,316 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math"
+	"math/big"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cxr29/tiny"
+)
+
+// RFC 8949 appendix A
+func TestMarshal(t *testing.T) {
+	for _, c := range []struct {
+		v interface{}
+		h string
+	}{
+		{0, "00"},
+		{23, "17"},
+		{24, "1818"},
+		{100, "1864"},
+		{1000, "1903e8"},
+		{uint64(math.MaxUint64), "1bffffffffffffffff"},
+		{-1, "20"},
+		{-1000, "3903e7"},
+		{0.0, "f90000"},
+		{math.Copysign(0, -1), "f98000"},
+		{1.0, "f93c00"},
+		{1.1, "fb3ff199999999999a"},
+		{1.5, "f93e00"},
+		{65504.0, "f97bff"},
+		{100000.0, "fa47c35000"},
+		{5.960464477539063e-8, "f90001"},
+		{0.00006103515625, "f90400"},
+		{-4.0, "f9c400"},
+		{math.Inf(1), "f97c00"},
+		{math.NaN(), "f97e00"},
+		{false, "f4"},
+		{true, "f5"},
+		{nil, "f6"},
+		{Simple(16), "f0"},
+		{Simple(255), "f8ff"},
+		{[]byte{1, 2, 3, 4}, "4401020304"},
+		{"IETF", "6449455446"},
+		{"ü", "62c3bc"},
+		{[]int{1, 2, 3}, "83010203"},
+		{map[int]int{1: 2, 3: 4}, "a201020304"},
+		{map[string]interface{}{"a": 1, "b": []int{2, 3}}, "a26161016162820203"},
+		{time.Unix(1363896240, 0), "c11a514b67b0"},
+		{time.Unix(1363896240, 500000000), "c1fb41d452d9ec200000"},
+		{new(big.Int).Lsh(big.NewInt(1), 64), "c249010000000000000000"},
+		{new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 64)), "3bffffffffffffffff"},
+		{Tag{32, "http://www.example.com"}, "d82076687474703a2f2f7777772e6578616d706c652e636f6d"},
+	} {
+		p, err := Marshal(c.v)
+		if err != nil || hex.EncodeToString(p) != c.h {
+			t.Errorf("Marshal(%#v) = %x, %v, want %s", c.v, p, err, c.h)
+		}
+	}
+}
+
+func TestUnmarshalInterface(t *testing.T) {
+	for _, c := range []struct {
+		h string
+		v interface{}
+	}{
+		{"f6", nil},
+		{"f5", true},
+		{"17", int64(23)},
+		{"3903e7", int64(-1000)},
+		{"1bffffffffffffffff", uint64(math.MaxUint64)},
+		{"3bffffffffffffffff", new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 64))},
+		{"c249010000000000000000", new(big.Int).Lsh(big.NewInt(1), 64)},
+		{"f93e00", 1.5},
+		{"6449455446", "IETF"},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"5f42010243030405ff", []byte{1, 2, 3, 4, 5}},
+		{"7f657374726561646d696e67ff", "streaming"},
+		{"9f018202039f0405ffff", []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+		{"bf61610161629f0203ffff", map[string]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+		{"d82076687474703a2f2f7777772e6578616d706c652e636f6d", Tag{32, "http://www.example.com"}},
+		{"f0", Simple(16)},
+	} {
+		p, _ := hex.DecodeString(c.h)
+		var v interface{}
+		if err := Unmarshal(p, &v); err != nil {
+			t.Errorf("%s: %v", c.h, err)
+		} else if !reflect.DeepEqual(v, c.v) {
+			t.Errorf("%s: got %#v, want %#v", c.h, v, c.v)
+		}
+	}
+	for _, h := range []string{"c074323031332d30332d32315432303a30343a30305a", "c11a514b67b0"} {
+		p, _ := hex.DecodeString(h)
+		var v interface{}
+		if err := Unmarshal(p, &v); err != nil {
+			t.Errorf("%s: %v", h, err)
+		} else if tm, ok := v.(time.Time); !ok || !tm.Equal(time.Unix(1363896240, 0)) {
+			t.Errorf("%s: got %#v", h, v)
+		}
+	}
+}
+
+type inner struct {
+	Z string `json:"z"`
+}
+
+type record struct {
+	inner
+	A int               `cbor:"a"`
+	B string            `json:"b,omitempty"`
+	C []byte            `cbor:"c,omitempty"`
+	D *float32          `json:"d"`
+	E map[string]uint16 `json:"e"`
+	F [2]int8
+	G time.Time
+	H big.Int
+	I interface{}
+	J bool `json:"-"`
+	L []record
+}
+
+func TestRoundTrip(t *testing.T) {
+	f := float32(1.25)
+	r := record{
+		inner: inner{"z"},
+		A:     -7,
+		C:     []byte("x"),
+		D:     &f,
+		E:     map[string]uint16{"q": 65535},
+		F:     [2]int8{-1, 1},
+		G:     time.Unix(1700000000, 0),
+		H:     *big.NewInt(-99),
+		I:     []interface{}{"a", int64(1)},
+		J:     true,
+		L:     []record{{A: 1}},
+	}
+	p, err := Marshal(&r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r2 record
+	if err := Unmarshal(p, &r2); err != nil {
+		t.Fatal(err)
+	}
+	if !r.G.Equal(r2.G) || r.H.Cmp(&r2.H) != 0 {
+		t.Errorf("got %v %v, want %v %v", r2.G, &r2.H, r.G, &r.H)
+	}
+	r.J = false
+	r2.G, r2.H = r.G, r.H
+	r2.L[0].G, r2.L[0].H = r.L[0].G, r.L[0].H
+	if !reflect.DeepEqual(r, r2) {
+		t.Errorf("got %+v, want %+v", r2, r)
+	}
+
+	var m map[string]interface{}
+	if err := Unmarshal(p, &m); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m["b"]; ok || m["z"] != "z" || m["a"] != int64(-7) {
+		t.Errorf("got %#v", m)
+	}
+
+	var bad struct{ L []struct{ A string } }
+	var te *UnmarshalTypeError
+	if err := Unmarshal(p, &bad); !errors.As(err, &te) || te.Field != "L.A" {
+		t.Errorf("got %v, want type error at L.A", err)
+	}
+}
+
+func TestUnmarshalMalformed(t *testing.T) {
+	for _, h := range []string{
+		"",
+		"1c",                 // reserved additional information
+		"ff",                 // break outside indefinite item
+		"0000",               // trailing data
+		"f818",               // simple value below 32 in two bytes
+		"5f4201ff",           // chunk of the wrong major type
+		"5f6101ff",           // text chunk in bytes
+		"a1820102",           // array map key
+		"bf6161",             // indefinite map without break
+		"c1f4",               // epoch of a bool
+		"5bffffffffffffffff", // bytes of 2^64-1
+		"7bffffffffffffffff", // text of 2^64-1
+		"9bffffffffffffffff", // array of 2^64-1
+		"bbffffffffffffffff", // map of 2^64-1
+		"9b00000000ffffffff", // array of 4G
+		"1bffffff",           // truncated uint64
+	} {
+		p, _ := hex.DecodeString(h)
+		var v interface{}
+		if err := Unmarshal(p, &v); err == nil {
+			t.Errorf("%s: got %#v, want error", h, v)
+		}
+	}
+}
+
+func TestUnmarshalTruncated(t *testing.T) {
+	p, err := Marshal(map[string]interface{}{
+		"a": []interface{}{int64(1), "two", 3.5, []byte{4}, nil, true},
+		"b": map[string]interface{}{"c": time.Unix(1, 5)},
+		"d": strings.Repeat("x", 300),
+		"e": new(big.Int).Lsh(big.NewInt(1), 100),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(p); i++ {
+		var v interface{}
+		var se *SyntaxError
+		if err := Unmarshal(p[:i], &v); !errors.As(err, &se) {
+			t.Fatalf("%d of %d bytes: got %v, want syntax error", i, len(p), err)
+		}
+	}
+}
+
+func TestDepth(t *testing.T) {
+	for _, c := range []struct {
+		open, close []byte
+	}{
+		{[]byte{0x81}, nil},
+		{[]byte{0x9f}, []byte{0xff}},
+		{[]byte{0xa1, 0x00}, nil},
+		{[]byte{0xd8, 0x20}, nil},
+	} {
+		p := append(bytes.Repeat(c.open, maxDepth+1), 0xf6)
+		p = append(p, bytes.Repeat(c.close, maxDepth+1)...)
+		var v interface{}
+		if err := Unmarshal(p, &v); err != errDepth {
+			t.Errorf("%x nested: got %v, want %v", c.open, err, errDepth)
+		}
+	}
+	p := append(bytes.Repeat([]byte{0x81}, maxDepth), 0xf6)
+	var v interface{}
+	if err := Unmarshal(p, &v); err != nil {
+		t.Errorf("%d nested arrays: %v", maxDepth, err)
+	}
+
+	var x interface{}
+	for i := 0; i <= maxDepth; i++ {
+		x = []interface{}{x}
+	}
+	if _, err := Marshal(x); err != errDepth {
+		t.Errorf("Marshal: got %v, want %v", err, errDepth)
+	}
+}
+
+func TestContext(t *testing.T) {
+	type item struct {
+		Name string `json:"name"`
+		N    int    `json:"n"`
+	}
+	r := new(tiny.Router)
+	r.GET("/value", func(ctx *tiny.Context) {
+		ctx.WriteValue(item{"a", 1})
+	})
+	r.GET("/write", func(ctx *tiny.Context) {
+		Write(ctx, item{"b", 2})
+	})
+	r.POST("/decode", func(ctx *tiny.Context) error {
+		var v item
+		if err := ctx.Decode(&v); err != nil {
+			return err
+		}
+		_, err := ctx.WriteJSON(v)
+		return err
+	})
+	h := r.Handler()
+	for _, c := range []struct {
+		path string
+		want item
+	}{
+		{"/value", item{"a", 1}},
+		{"/write", item{"b", 2}},
+	} {
+		req := httptest.NewRequest("GET", c.path, nil)
+		req.Header.Set("Accept", MediaType)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		var v item
+		if w.Header().Get("Content-Type") != MediaType {
+			t.Errorf("%s: Content-Type %q", c.path, w.Header().Get("Content-Type"))
+		} else if err := Unmarshal(w.Body.Bytes(), &v); err != nil || v != c.want {
+			t.Errorf("%s: got %+v %v, want %+v", c.path, v, err, c.want)
+		}
+	}
+	good, _ := Marshal(map[string]interface{}{"name": "c", "n": 3})
+	bad, _ := Marshal(map[string]interface{}{"name": "c", "n": "3"})
+	for _, c := range []struct {
+		body   []byte
+		status int
+		want   string
+	}{
+		{good, 200, `{"name":"c","n":3}`},
+		{bad, 400, "n"},
+		{nil, 400, "empty body"},
+		{[]byte{0xc1}, 400, ""},
+	} {
+		req := httptest.NewRequest("POST", "/decode", bytes.NewReader(c.body))
+		req.Header.Set("Content-Type", MediaType)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != c.status || !strings.Contains(w.Body.String(), c.want) {
+			t.Errorf("%x: got %d %s, want %d %s", c.body, w.Code, w.Body, c.status, c.want)
+		}
+	}
+}
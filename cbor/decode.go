@@ -0,0 +1,652 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package cbor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cxr29/tiny/internal/fields"
+)
+
+type SyntaxError struct {
+	msg    string
+	Offset int64
+}
+
+func (e *SyntaxError) Error() string {
+	return "cbor: " + e.msg + " at offset " + strconv.FormatInt(e.Offset, 10)
+}
+
+type UnmarshalTypeError struct {
+	Value  string
+	Type   reflect.Type
+	Offset int64
+	Field  string
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	if e.Field != "" {
+		return "cbor: cannot unmarshal " + e.Value + " into field " + e.Field + " of type " + e.Type.String()
+	}
+	return "cbor: cannot unmarshal " + e.Value + " into value of type " + e.Type.String()
+}
+
+// maps decode into map[string]interface{} if all keys are strings,
+// integers into int64, uint64 or *big.Int, epochs and date/time strings into time.Time
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("cbor: Unmarshal(non-pointer %T)", v)
+	}
+	d := &decoder{data: data}
+	if err := d.value(rv.Elem()); err != nil {
+		return err
+	}
+	if d.off < len(d.data) {
+		return d.syntax("trailing data")
+	}
+	return nil
+}
+
+const (
+	kUint = iota
+	kNeg
+	kBytes
+	kText
+	kArray
+	kMap
+	kTag
+	kBool
+	kNil
+	kFloat
+	kSimple
+	kBreak
+)
+
+var kindNames = [...]string{"integer", "integer", "byte string", "text string", "array", "map", "tag", "bool", "null", "float", "simple value", "break"}
+
+type token struct {
+	kind  int
+	u     uint64 // argument, -1-u for negative integers
+	n     int    // length of strings, arrays and maps
+	indef bool
+	b     bool
+	f     float64
+	off   int
+}
+
+type decoder struct {
+	data   []byte
+	off    int
+	depth  int
+	fields []string
+}
+
+func (d *decoder) syntax(msg string) error {
+	return &SyntaxError{msg, int64(d.off)}
+}
+
+func (d *decoder) typeError(t token, typ reflect.Type) error {
+	return &UnmarshalTypeError{kindNames[t.kind], typ, int64(t.off), strings.Join(d.fields, ".")}
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	if n > len(d.data)-d.off {
+		return nil, d.syntax("unexpected end of data")
+	}
+	p := d.data[d.off : d.off+n]
+	d.off += n
+	return p, nil
+}
+
+func (d *decoder) head() (t token, err error) {
+	t.off = d.off
+	p, err := d.read(1)
+	if err != nil {
+		return
+	}
+	major, ai := p[0]>>5, p[0]&0x1f
+	switch {
+	case ai < 24:
+		t.u = uint64(ai)
+	case ai <= 27:
+		if p, err = d.read(1 << (ai - 24)); err != nil {
+			return
+		}
+		switch len(p) {
+		case 1:
+			t.u = uint64(p[0])
+		case 2:
+			t.u = uint64(binary.BigEndian.Uint16(p))
+		case 4:
+			t.u = uint64(binary.BigEndian.Uint32(p))
+		default:
+			t.u = binary.BigEndian.Uint64(p)
+		}
+	case ai == 31 && major >= 2 && major <= 5:
+		t.indef = true
+	case ai == 31 && major == 7:
+		t.kind = kBreak
+		return
+	default:
+		err = d.syntax("invalid additional information")
+		return
+	}
+	t.kind = int(major)
+	switch major {
+	case 2, 3, 4:
+		if !t.indef {
+			if t.u > uint64(len(d.data)-d.off) {
+				err = d.syntax("length exceeds data")
+			}
+			t.n = int(t.u)
+		}
+	case 5:
+		if !t.indef {
+			if t.u > uint64(len(d.data)-d.off)/2 {
+				err = d.syntax("length exceeds data")
+			}
+			t.n = int(t.u)
+		}
+	case 7:
+		switch ai {
+		case 20, 21:
+			t.kind, t.b = kBool, ai == 21
+		case 22, 23:
+			t.kind = kNil
+		case 24:
+			if t.u < 32 {
+				err = d.syntax("invalid simple value")
+			}
+			t.kind = kSimple
+		case 25:
+			t.kind, t.f = kFloat, float16bits(uint16(t.u))
+		case 26:
+			t.kind, t.f = kFloat, float64(math.Float32frombits(uint32(t.u)))
+		case 27:
+			t.kind, t.f = kFloat, math.Float64frombits(t.u)
+		default:
+			t.kind = kSimple
+		}
+	}
+	return
+}
+
+func float16bits(h uint16) float64 {
+	exp, mant := int(h>>10&0x1f), float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+0x400, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
+
+func (d *decoder) nested(f func() error) error {
+	if d.depth++; d.depth > maxDepth {
+		return errDepth
+	}
+	err := f()
+	d.depth--
+	return err
+}
+
+// the items of an array or the pairs of a map, until the break if indefinite
+func (d *decoder) each(t token, f func() error) error {
+	return d.nested(func() error {
+		for i := 0; t.indef || i < t.n; i++ {
+			if t.indef {
+				if d.off >= len(d.data) {
+					return d.syntax("unexpected end of data")
+				}
+				if d.data[d.off] == 0xff {
+					d.off++
+					return nil
+				}
+			}
+			if err := f(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// the chunks of an indefinite string are concatenated
+func (d *decoder) str(t token) ([]byte, error) {
+	if !t.indef {
+		return d.read(t.n)
+	}
+	var b []byte
+	for {
+		c, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if c.kind == kBreak {
+			return b, nil
+		}
+		if c.kind != t.kind || c.indef {
+			return nil, d.syntax("invalid chunk")
+		}
+		p, err := d.read(c.n)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, p...)
+	}
+}
+
+func (d *decoder) skip() error {
+	_, err := d.any()
+	return err
+}
+
+func (d *decoder) value(v reflect.Value) error {
+	if d.off < len(d.data) && (d.data[d.off] == 0xf6 || d.data[d.off] == 0xf7) {
+		d.off++
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+	if v.CanAddr() && reflect.PtrTo(v.Type()).Implements(unmarshalerType) {
+		start := d.off
+		if err := d.skip(); err != nil {
+			return err
+		}
+		return v.Addr().Interface().(Unmarshaler).UnmarshalCBOR(d.data[start:d.off])
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.value(v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() == 0 {
+			x, err := d.any()
+			if err == nil {
+				v.Set(reflect.ValueOf(&x).Elem())
+			}
+			return err
+		}
+	}
+	switch v.Type() {
+	case timeType, bigIntType, tagType:
+		off := d.off
+		x, err := d.any()
+		if err != nil {
+			return err
+		}
+		return d.convert(x, v, off)
+	}
+	t, err := d.head()
+	if err != nil {
+		return err
+	}
+	switch t.kind {
+	case kTag:
+		return d.nested(func() error {
+			return d.value(v)
+		})
+	case kBool:
+		if v.Kind() != reflect.Bool {
+			return d.typeError(t, v.Type())
+		}
+		v.SetBool(t.b)
+	case kUint, kNeg, kFloat:
+		return d.number(t, v)
+	case kSimple:
+		if v.Type() != reflect.TypeOf(Simple(0)) {
+			return d.typeError(t, v.Type())
+		}
+		v.SetUint(t.u)
+	case kBytes, kText:
+		p, err := d.str(t)
+		if err != nil {
+			return err
+		}
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(p))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(append([]byte(nil), p...))
+		default:
+			return d.typeError(t, v.Type())
+		}
+	case kArray:
+		return d.array(t, v)
+	case kMap:
+		return d.mapValue(t, v)
+	default:
+		return d.syntax("unexpected break")
+	}
+	return nil
+}
+
+// time.Time, big.Int and Tag from the generic value
+func (d *decoder) convert(x interface{}, v reflect.Value, off int) error {
+	switch v.Type() {
+	case timeType:
+		switch x := x.(type) {
+		case time.Time:
+			v.Set(reflect.ValueOf(x))
+			return nil
+		case int64:
+			v.Set(reflect.ValueOf(time.Unix(x, 0)))
+			return nil
+		case float64:
+			if !math.IsNaN(x) && !math.IsInf(x, 0) {
+				sec, frac := math.Modf(x)
+				v.Set(reflect.ValueOf(time.Unix(int64(sec), int64(frac*1e9))))
+				return nil
+			}
+		case string:
+			tm, err := time.Parse(time.RFC3339Nano, x)
+			if err != nil {
+				return d.syntax("invalid date/time string")
+			}
+			v.Set(reflect.ValueOf(tm))
+			return nil
+		}
+	case bigIntType:
+		switch x := x.(type) {
+		case *big.Int:
+			v.Set(reflect.ValueOf(*x))
+			return nil
+		case int64:
+			v.Set(reflect.ValueOf(*big.NewInt(x)))
+			return nil
+		case uint64:
+			v.Set(reflect.ValueOf(*new(big.Int).SetUint64(x)))
+			return nil
+		}
+	case tagType:
+		if x, ok := x.(Tag); ok {
+			v.Set(reflect.ValueOf(x))
+			return nil
+		}
+	}
+	return &UnmarshalTypeError{fmt.Sprintf("%T", x), v.Type(), int64(off), strings.Join(d.fields, ".")}
+}
+
+func (d *decoder) number(t token, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if t.kind == kFloat || t.u > math.MaxInt64 {
+			return d.typeError(t, v.Type())
+		}
+		i := int64(t.u)
+		if t.kind == kNeg {
+			i = -1 - i
+		}
+		if v.OverflowInt(i) {
+			return d.typeError(t, v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if t.kind != kUint || v.OverflowUint(t.u) {
+			return d.typeError(t, v.Type())
+		}
+		v.SetUint(t.u)
+	case reflect.Float32, reflect.Float64:
+		f := t.f
+		switch t.kind {
+		case kUint:
+			f = float64(t.u)
+		case kNeg:
+			f = -1 - float64(t.u)
+		}
+		if v.OverflowFloat(f) && !math.IsInf(f, 0) {
+			return d.typeError(t, v.Type())
+		}
+		v.SetFloat(f)
+	default:
+		return d.typeError(t, v.Type())
+	}
+	return nil
+}
+
+func (d *decoder) array(t token, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.IsNil() || v.Cap() < t.n {
+			v.Set(reflect.MakeSlice(v.Type(), t.n, t.n))
+		} else {
+			v.SetLen(t.n)
+		}
+	case reflect.Array:
+	default:
+		return d.typeError(t, v.Type())
+	}
+	i := 0
+	err := d.each(t, func() error {
+		defer func() {
+			i++
+		}()
+		if v.Kind() == reflect.Slice && i >= v.Len() {
+			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+		}
+		if i >= v.Len() {
+			return d.skip()
+		}
+		return d.value(v.Index(i))
+	})
+	if err != nil {
+		return err
+	}
+	if v.Kind() == reflect.Array {
+		for ; i < v.Len(); i++ {
+			v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+		}
+	} else if i < v.Len() {
+		v.SetLen(i)
+	}
+	return nil
+}
+
+func (d *decoder) mapValue(t token, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		a := fields.Of(v.Type(), TagName)
+		return d.each(t, func() error {
+			k, err := d.head()
+			if err != nil {
+				return err
+			}
+			if k.kind != kText {
+				return d.typeError(k, reflect.TypeOf(""))
+			}
+			p, err := d.str(k)
+			if err != nil {
+				return err
+			}
+			f := fields.ByName(a, string(p))
+			if f == nil {
+				return d.skip()
+			}
+			d.fields = append(d.fields, f.Name)
+			if err := d.value(v.FieldByIndex(f.Index)); err != nil {
+				return err
+			}
+			d.fields = d.fields[:len(d.fields)-1]
+			return nil
+		})
+	case reflect.Map:
+		typ := v.Type()
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(typ, t.n))
+		}
+		return d.each(t, func() error {
+			off := d.off
+			k := reflect.New(typ.Key()).Elem()
+			if err := d.value(k); err != nil {
+				return err
+			}
+			if k.Kind() == reflect.Interface && !k.IsNil() && !k.Elem().Type().Comparable() {
+				d.off = off
+				return d.syntax("unhashable map key")
+			}
+			e := reflect.New(typ.Elem()).Elem()
+			if err := d.value(e); err != nil {
+				return err
+			}
+			v.SetMapIndex(k, e)
+			return nil
+		})
+	}
+	return d.typeError(t, v.Type())
+}
+
+func (d *decoder) any() (interface{}, error) {
+	t, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch t.kind {
+	case kUint:
+		if t.u <= math.MaxInt64 {
+			return int64(t.u), nil
+		}
+		return t.u, nil
+	case kNeg:
+		if t.u <= math.MaxInt64 {
+			return -1 - int64(t.u), nil
+		}
+		b := new(big.Int).SetUint64(t.u)
+		return b.Neg(b.Add(b, big.NewInt(1))), nil
+	case kBytes:
+		p, err := d.str(t)
+		return append([]byte(nil), p...), err
+	case kText:
+		p, err := d.str(t)
+		return string(p), err
+	case kBool:
+		return t.b, nil
+	case kNil:
+		return nil, nil
+	case kFloat:
+		return t.f, nil
+	case kSimple:
+		return Simple(t.u), nil
+	case kArray:
+		a := make([]interface{}, 0, t.n)
+		err := d.each(t, func() error {
+			x, err := d.any()
+			a = append(a, x)
+			return err
+		})
+		return a, err
+	case kMap:
+		return d.anyMap(t)
+	case kTag:
+		var x interface{}
+		err := d.nested(func() error {
+			var err error
+			x, err = d.any()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return d.tag(t, x)
+	}
+	return nil, d.syntax("unexpected break")
+}
+
+func (d *decoder) tag(t token, x interface{}) (interface{}, error) {
+	switch t.u {
+	case tagDateTime:
+		if s, ok := x.(string); ok {
+			tm, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return nil, &SyntaxError{"invalid date/time string", int64(t.off)}
+			}
+			return tm, nil
+		}
+	case tagEpoch:
+		switch x := x.(type) {
+		case int64:
+			return time.Unix(x, 0), nil
+		case float64:
+			if !math.IsNaN(x) && !math.IsInf(x, 0) {
+				sec, frac := math.Modf(x)
+				return time.Unix(int64(sec), int64(frac*1e9)), nil
+			}
+		}
+	case tagPosBignum, tagNegBignum:
+		if p, ok := x.([]byte); ok {
+			b := new(big.Int).SetBytes(p)
+			if t.u == tagNegBignum {
+				b.Neg(b.Add(b, big.NewInt(1)))
+			}
+			return b, nil
+		}
+	case tagSelfDescribe:
+		return x, nil
+	default:
+		return Tag{t.u, x}, nil
+	}
+	return nil, &SyntaxError{"invalid content of tag " + strconv.FormatUint(t.u, 10), int64(t.off)}
+}
+
+func (d *decoder) anyMap(t token) (interface{}, error) {
+	m := make(map[string]interface{}, t.n)
+	var mi map[interface{}]interface{}
+	err := d.each(t, func() error {
+		off := d.off
+		k, err := d.any()
+		if err != nil {
+			return err
+		}
+		v, err := d.any()
+		if err != nil {
+			return err
+		}
+		if s, ok := k.(string); ok && mi == nil {
+			m[s] = v
+			return nil
+		}
+		if k != nil && !reflect.TypeOf(k).Comparable() {
+			d.off = off
+			return d.syntax("unhashable map key")
+		}
+		if mi == nil {
+			mi = make(map[interface{}]interface{}, t.n)
+			for s, v := range m {
+				mi[s] = v
+			}
+		}
+		mi[k] = v
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if mi != nil {
+		return mi, nil
+	}
+	return m, nil
+}
@@ -0,0 +1,391 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+// CBOR (RFC 8949), struct fields are tagged like encoding/json with cbor or json
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/cxr29/tiny/internal/fields"
+)
+
+const TagName = "cbor" // falls back to json
+
+const maxDepth = 10000
+
+const (
+	majorUint byte = iota << 5
+	majorNeg
+	majorBytes
+	majorText
+	majorArray
+	majorMap
+	majorTag
+	majorSimple
+)
+
+const (
+	tagDateTime     = 0
+	tagEpoch        = 1
+	tagPosBignum    = 2
+	tagNegBignum    = 3
+	tagSelfDescribe = 55799
+)
+
+var (
+	marshalerType   = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	timeType        = reflect.TypeOf(time.Time{})
+	bigIntType      = reflect.TypeOf(big.Int{})
+	tagType         = reflect.TypeOf(Tag{})
+
+	errDepth = errors.New("cbor: exceeded max depth")
+)
+
+type Marshaler interface {
+	MarshalCBOR() ([]byte, error)
+}
+
+type Unmarshaler interface {
+	UnmarshalCBOR([]byte) error
+}
+
+// tags other than date/time and bignums
+type Tag struct {
+	Number  uint64
+	Content interface{}
+}
+
+type Simple uint8
+
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return "cbor: unsupported type: " + e.Type.String()
+}
+
+// preferred serialization, map keys are sorted bytewise and time.Time is an epoch
+func Marshal(v interface{}) ([]byte, error) {
+	e := new(encoder)
+	if err := e.value(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+type encoder struct {
+	buf   []byte
+	depth int
+}
+
+func (e *encoder) head(major byte, u uint64) {
+	switch {
+	case u < 24:
+		e.buf = append(e.buf, major|byte(u))
+	case u <= math.MaxUint8:
+		e.buf = append(e.buf, major|24, byte(u))
+	case u <= math.MaxUint16:
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, major|25), uint16(u))
+	case u <= math.MaxUint32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, major|26), uint32(u))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, major|27), u)
+	}
+}
+
+func (e *encoder) encodeInt(i int64) {
+	if i < 0 {
+		e.head(majorNeg, uint64(-1-i))
+	} else {
+		e.head(majorUint, uint64(i))
+	}
+}
+
+// the shortest of half, single and double precision that keeps the value
+func (e *encoder) encodeFloat(f float64) {
+	if math.IsNaN(f) {
+		e.buf = append(e.buf, majorSimple|25, 0x7e, 0x00)
+		return
+	}
+	f32 := float32(f)
+	if float64(f32) != f {
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, majorSimple|27), math.Float64bits(f))
+		return
+	}
+	if h, ok := float16(f32); ok {
+		e.buf = binary.BigEndian.AppendUint16(append(e.buf, majorSimple|25), h)
+		return
+	}
+	e.buf = binary.BigEndian.AppendUint32(append(e.buf, majorSimple|26), math.Float32bits(f32))
+}
+
+func float16(f float32) (uint16, bool) {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23&0xff) - 127
+	mant := bits & 0x7fffff
+	switch {
+	case bits&0x7fffffff == 0:
+		return sign, true
+	case exp == 128:
+		if mant == 0 {
+			return sign | 0x7c00, true
+		}
+		return 0, false
+	case exp >= -14 && exp <= 15:
+		if mant&0x1fff != 0 {
+			return 0, false
+		}
+		return sign | uint16(exp+15)<<10 | uint16(mant>>13), true
+	case exp >= -24 && exp < -14:
+		full, shift := mant|1<<23, uint(13-14-exp)
+		if full&(1<<shift-1) != 0 {
+			return 0, false
+		}
+		return sign | uint16(full>>shift), true
+	}
+	return 0, false
+}
+
+func (e *encoder) encodeTime(t time.Time) {
+	e.head(majorTag, tagEpoch)
+	if t.Nanosecond() == 0 {
+		e.encodeInt(t.Unix())
+	} else {
+		e.encodeFloat(float64(t.UnixNano()) / 1e9)
+	}
+}
+
+func (e *encoder) encodeBigInt(b *big.Int) {
+	if b.IsInt64() {
+		e.encodeInt(b.Int64())
+		return
+	}
+	if b.IsUint64() {
+		e.head(majorUint, b.Uint64())
+		return
+	}
+	if b.Sign() > 0 {
+		e.head(majorTag, tagPosBignum)
+		p := b.Bytes()
+		e.head(majorBytes, uint64(len(p)))
+		e.buf = append(e.buf, p...)
+		return
+	}
+	n := new(big.Int).Neg(b)
+	n.Sub(n, big.NewInt(1))
+	if n.IsUint64() {
+		e.head(majorNeg, n.Uint64())
+		return
+	}
+	e.head(majorTag, tagNegBignum)
+	p := n.Bytes()
+	e.head(majorBytes, uint64(len(p)))
+	e.buf = append(e.buf, p...)
+}
+
+func (e *encoder) value(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf = append(e.buf, majorSimple|22)
+		return nil
+	}
+	t := v.Type()
+	if t.Kind() != reflect.Ptr && v.CanAddr() && reflect.PtrTo(t).Implements(marshalerType) {
+		v, t = v.Addr(), v.Addr().Type()
+	}
+	if t.Implements(marshalerType) {
+		if (t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface) && v.IsNil() {
+			e.buf = append(e.buf, majorSimple|22)
+			return nil
+		}
+		p, err := v.Interface().(Marshaler).MarshalCBOR()
+		if err != nil {
+			return err
+		}
+		e.buf = append(e.buf, p...)
+		return nil
+	}
+	switch t {
+	case timeType:
+		e.encodeTime(v.Interface().(time.Time))
+		return nil
+	case bigIntType:
+		b := v.Interface().(big.Int)
+		e.encodeBigInt(&b)
+		return nil
+	case tagType:
+		x := v.Interface().(Tag)
+		e.head(majorTag, x.Number)
+		return e.nested(func() error {
+			return e.value(reflect.ValueOf(x.Content))
+		})
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, majorSimple|21)
+		} else {
+			e.buf = append(e.buf, majorSimple|20)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.encodeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if t == reflect.TypeOf(Simple(0)) {
+			if u := v.Uint(); u < 24 {
+				e.buf = append(e.buf, majorSimple|byte(u))
+			} else {
+				e.buf = append(e.buf, majorSimple|24, byte(u))
+			}
+			return nil
+		}
+		e.head(majorUint, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		e.encodeFloat(v.Float())
+	case reflect.String:
+		e.head(majorText, uint64(v.Len()))
+		e.buf = append(e.buf, v.String()...)
+	case reflect.Slice:
+		if v.IsNil() {
+			e.buf = append(e.buf, majorSimple|22)
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			e.head(majorBytes, uint64(v.Len()))
+			e.buf = append(e.buf, v.Bytes()...)
+			return nil
+		}
+		return e.array(v)
+	case reflect.Array:
+		return e.array(v)
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf = append(e.buf, majorSimple|22)
+			return nil
+		}
+		return e.mapValue(v)
+	case reflect.Struct:
+		return e.structValue(v)
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.buf = append(e.buf, majorSimple|22)
+			return nil
+		}
+		return e.nested(func() error {
+			return e.value(v.Elem())
+		})
+	default:
+		return &UnsupportedTypeError{t}
+	}
+	return nil
+}
+
+func (e *encoder) nested(f func() error) error {
+	if e.depth++; e.depth > maxDepth {
+		return errDepth
+	}
+	err := f()
+	e.depth--
+	return err
+}
+
+func (e *encoder) array(v reflect.Value) error {
+	e.head(majorArray, uint64(v.Len()))
+	return e.nested(func() error {
+		for i := 0; i < v.Len(); i++ {
+			if err := e.value(v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (e *encoder) mapValue(v reflect.Value) error {
+	type pair struct {
+		k []byte
+		v reflect.Value
+	}
+	a := make([]pair, 0, v.Len())
+	buf := e.buf
+	err := e.nested(func() error {
+		for it := v.MapRange(); it.Next(); {
+			e.buf = nil
+			if err := e.value(it.Key()); err != nil {
+				return err
+			}
+			a = append(a, pair{e.buf, it.Value()})
+		}
+		return nil
+	})
+	e.buf = buf
+	if err != nil {
+		return err
+	}
+	sort.Slice(a, func(i, j int) bool {
+		return bytes.Compare(a[i].k, a[j].k) < 0
+	})
+	e.head(majorMap, uint64(len(a)))
+	return e.nested(func() error {
+		for _, i := range a {
+			e.buf = append(e.buf, i.k...)
+			if err := e.value(i.v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (e *encoder) structValue(v reflect.Value) error {
+	a := fields.Of(v.Type(), TagName)
+	n := 0
+	for _, f := range a {
+		if !f.OmitEmpty || !isEmpty(v.FieldByIndex(f.Index)) {
+			n++
+		}
+	}
+	e.head(majorMap, uint64(n))
+	return e.nested(func() error {
+		for _, f := range a {
+			fv := v.FieldByIndex(f.Index)
+			if f.OmitEmpty && isEmpty(fv) {
+				continue
+			}
+			e.head(majorText, uint64(len(f.Name)))
+			e.buf = append(e.buf, f.Name...)
+			if err := e.value(fv); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"reflect"
+	"strings"
+)
+
+type named struct {
+	name string
+	Handler
+}
+
+func Named(name string, handler interface{}) Handler {
+	if name == "" {
+		panic("empty middleware name")
+	}
+	return &named{name, newHandler(handler)}
+}
+
+type Condition struct {
+	route   func(*Node) (result, decided bool)
+	request func(*Context) bool
+}
+
+type conditional struct {
+	c      Condition
+	negate bool
+	Handler
+}
+
+func (x *conditional) ServeHTTP(ctx *Context) {
+	if x.c.request(ctx) != x.negate {
+		x.Handler.ServeHTTP(ctx)
+	}
+}
+
+func When(c Condition, handler interface{}) Handler {
+	return &conditional{c, false, newHandler(handler)}
+}
+
+func Unless(c Condition, handler interface{}) Handler {
+	return &conditional{c, true, newHandler(handler)}
+}
+
+func Predicate(f func(*Context) bool) Condition {
+	return Condition{request: f}
+}
+
+func staticPrefix(pattern string) (string, bool) {
+	if i := strings.IndexByte(pattern, meta[1]); i >= 0 {
+		return pattern[:i], false
+	}
+	return pattern, true
+}
+
+func PathPrefix(prefix string) Condition {
+	return Condition{
+		route: func(n *Node) (bool, bool) {
+			s, whole := staticPrefix(n.pattern)
+			if whole || len(s) >= len(prefix) {
+				return strings.HasPrefix(s, prefix), true
+			}
+			if !strings.HasPrefix(prefix, s) {
+				return false, true
+			}
+			return false, false
+		},
+		request: func(ctx *Context) bool {
+			return strings.HasPrefix(ctx.Request.URL.Path, prefix)
+		},
+	}
+}
+
+func Method(methods ...string) Condition {
+	has := func(s string) bool {
+		for _, m := range methods {
+			if m == s {
+				return true
+			}
+		}
+		return false
+	}
+	return Condition{
+		route: func(n *Node) (bool, bool) {
+			if n.method == "" {
+				return false, false
+			}
+			return has(n.method), true
+		},
+		request: func(ctx *Context) bool {
+			return has(ctx.Request.Method)
+		},
+	}
+}
+
+func Header(key, value string) Condition {
+	return Condition{request: func(ctx *Context) bool {
+		if value == "" {
+			return len(ctx.Request.Header.Values(key)) > 0
+		}
+		return ctx.Request.Header.Get(key) == value
+	}}
+}
+
+func hasMeta(m map[string]interface{}, key string, value interface{}) bool {
+	v, ok := m[key]
+	return ok && (value == nil || reflect.DeepEqual(v, value))
+}
+
+func Meta(key string, value interface{}) Condition {
+	return Condition{
+		route: func(n *Node) (bool, bool) {
+			return hasMeta(n.meta, key, value), true
+		},
+		request: func(ctx *Context) bool {
+			return ctx.Routed() && hasMeta(ctx.node.meta, key, value)
+		},
+	}
+}
+
+func (rr *Route) Meta(key string, value interface{}) *Route {
+	if rr.meta == nil {
+		rr.meta = make(map[string]interface{}, 4)
+	}
+	rr.meta[key] = value
+	return rr
+}
+
+func (ctx *Context) Meta(key string) interface{} {
+	if ctx.Routed() {
+		return ctx.node.meta[key]
+	}
+	return nil
+}
+
+func (r *Router) Skip(names ...string) {
+	r.skips = append(r.skips, names...)
+}
+
+func (rr *Route) Skip(names ...string) *Route {
+	rr.skips = append(rr.skips, names...)
+	return rr
+}
+
+func contains(a []string, s string) bool {
+	for _, i := range a {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
+
+// nil if the handler is skipped or its condition never holds for the node,
+// handlers are not comparable so report whether it has changed
+func resolve(h Handler, n *Node, skips []string) (Handler, bool) {
+	switch x := h.(type) {
+	case *named:
+		if contains(skips, x.name) {
+			return nil, true
+		}
+		if y, changed := resolve(x.Handler, n, skips); changed {
+			if y == nil {
+				return nil, true
+			}
+			return &named{x.name, y}, true
+		}
+	case *conditional:
+		if n != nil && x.c.route != nil {
+			if result, decided := x.c.route(n); decided {
+				if result != x.negate {
+					y, _ := resolve(x.Handler, n, skips)
+					return y, true
+				}
+				return nil, true
+			}
+		}
+		if y, changed := resolve(x.Handler, n, skips); changed {
+			if y == nil {
+				return nil, true
+			}
+			return &conditional{x.c, x.negate, y}, true
+		}
+	}
+	return h, false
+}
+
+// skipped handlers are left nil to keep the indexes
+func resolveHandlers(handlers []Handler, n *Node, skips []string) (a []Handler, changed bool) {
+	if len(handlers) > 0 {
+		a = make([]Handler, len(handlers))
+		for i, h := range handlers {
+			var ok bool
+			if a[i], ok = resolve(h, n, skips); ok {
+				changed = true
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	var got []string
+	mark := func(s string) func(*Context) {
+		return func(*Context) { got = append(got, s) }
+	}
+	r := new(Router)
+	r.Use(
+		Named("auth", mark("auth")),
+		When(PathPrefix("/api/"), mark("api")),
+		Unless(Method("GET", "HEAD"), mark("write")),
+		When(Header("X-Debug", ""), mark("debug")),
+		When(Meta("cache", nil), Named("cache", mark("cache"))),
+		When(Predicate(func(ctx *Context) bool { return ctx.Request.URL.RawQuery != "" }), mark("query")),
+	)
+	r.GET("/", mark("home"))
+	r.GET("/api/items", mark("items")).Meta("cache", true)
+	r.POST("/api/items", mark("create"))
+	r.GET("/api/<name:str>", mark("named")).Skip("auth", "cache")
+	r.Group("/public", func(r *Router) {
+		r.Skip("auth")
+		r.GET("/a", mark("a")).Meta("cache", true)
+	})
+	h := r.Handler()
+	for _, c := range []struct {
+		method, target, debug string
+		want                  []string
+	}{
+		{"GET", "/", "", []string{"auth", "home"}},
+		{"GET", "/?q", "1", []string{"auth", "debug", "query", "home"}},
+		{"GET", "/api/items", "", []string{"auth", "api", "cache", "items"}},
+		{"POST", "/api/items", "", []string{"auth", "api", "write", "create"}},
+		{"GET", "/api/x", "", []string{"api", "named"}},
+		{"GET", "/public/a", "", []string{"cache", "a"}},
+	} {
+		got = nil
+		req := httptest.NewRequest(c.method, c.target, nil)
+		if c.debug != "" {
+			req.Header.Set("X-Debug", c.debug)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s %s: got %v, want %v", c.method, c.target, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package coalesce
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/cxr29/tiny"
+)
+
+// opt in routes with tiny.When(tiny.Meta(MetaKey, nil), New(nil))
+const MetaKey = "coalesce"
+
+type Options struct {
+	Key      func(*tiny.Context) string // defaults to method, path, query, negotiation headers and Headers, requests with credentials not in Headers are not coalesced
+	Headers  []string
+	MaxBytes int // larger responses are not replayed, the waiters run the handlers themselves
+}
+
+var (
+	DefaultOptions = &Options{
+		MaxBytes: 1 << 20,
+	}
+	negotiation = [...]string{"Accept", "Accept-Encoding", "Accept-Language"}
+	conditional = [...]string{"Range", "If-Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"}
+)
+
+type call struct {
+	done   chan struct{}
+	ok     bool
+	res    *tiny.Response
+	header http.Header // of the first request
+}
+
+func (o *Options) key(ctx *tiny.Context) string {
+	if o.Key != nil {
+		return o.Key(ctx)
+	}
+	r := ctx.Request
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteString(" ")
+	b.WriteString(r.URL.Path)
+	b.WriteString("?")
+	b.WriteString(r.URL.RawQuery)
+	for _, k := range negotiation {
+		b.WriteString("\n")
+		b.WriteString(strings.Join(r.Header.Values(k), ", "))
+	}
+	for _, k := range o.Headers {
+		b.WriteString("\n")
+		b.WriteString(strings.Join(r.Header.Values(k), ", "))
+	}
+	return b.String()
+}
+
+func (o *Options) credentialed(r *http.Request) bool {
+Loop:
+	for _, k := range [...]string{"Authorization", "Cookie"} {
+		if r.Header.Get(k) == "" {
+			continue
+		}
+		for _, s := range o.Headers {
+			if http.CanonicalHeaderKey(s) == k {
+				continue Loop
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// whether the request headers named by the response's Vary are the same
+func sameVary(res, a, b http.Header) bool {
+	for _, v := range res.Values("Vary") {
+		for _, k := range strings.Split(v, ",") {
+			if k = strings.TrimSpace(k); k == "*" {
+				return false
+			} else if k != "" && strings.Join(a.Values(k), ", ") != strings.Join(b.Values(k), ", ") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func conditionalOrRange(r *http.Request) bool {
+	for _, k := range conditional {
+		if r.Header.Get(k) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func New(o *Options) tiny.HandlerFunc {
+	if o == nil {
+		o = DefaultOptions
+	}
+	var (
+		mu    sync.Mutex
+		calls = make(map[string]*call)
+	)
+	return func(ctx *tiny.Context) {
+		r := ctx.Request
+		if r.Method != "GET" && r.Method != "HEAD" || conditionalOrRange(r) ||
+			o.Key == nil && o.credentialed(r) {
+			return
+		}
+		k := o.key(ctx)
+		mu.Lock()
+		if c, ok := calls[k]; ok {
+			mu.Unlock()
+			select {
+			case <-c.done:
+				if c.ok && sameVary(c.res.Header, c.header, r.Header) {
+					ctx.Replay(c.res)
+				}
+			case <-r.Context().Done():
+				ctx.Abort()
+			}
+			return
+		}
+		c := &call{done: make(chan struct{}), header: r.Header.Clone()}
+		calls[k] = c
+		mu.Unlock()
+		b := ctx.Buffer(o.MaxBytes)
+		ctx.OnFinish(func() {
+			defer func() {
+				mu.Lock()
+				delete(calls, k)
+				mu.Unlock()
+				close(c.done)
+			}()
+			if ctx.Panicked() || b.Spilled() {
+				return
+			}
+			c.res = b.Response()
+			c.ok = c.res.Header.Get("Set-Cookie") == ""
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package coalesce
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cxr29/tiny"
+)
+
+func get(h http.Handler, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/items?a=1", nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestCoalesce(t *testing.T) {
+	var n int32
+	started, release := make(chan struct{}), make(chan struct{})
+	r := new(tiny.Router)
+	r.Use(New(nil))
+	r.GET("/items", func(ctx *tiny.Context) {
+		i := atomic.AddInt32(&n, 1)
+		if i == 1 {
+			close(started)
+			<-release
+		}
+		ctx.Vary("X-Tenant")
+		ctx.Header().Set("ETag", `"v1"`)
+		ctx.WriteString("run " + strconv.Itoa(int(i)))
+	})
+	h := r.Handler()
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- get(h, "X-Tenant", "a") }()
+	<-started
+
+	// not coalesced, run while the first is in flight
+	for _, header := range [][]string{
+		{"If-None-Match", `"v1"`},
+		{"Range", "bytes=0-1"},
+		{"X-Tenant", "a", "Accept", "text/plain"},
+		{"X-Tenant", "a", "Authorization", "Bearer x"},
+	} {
+		if w := get(h, header...); w.Body.String() == "run 1" {
+			t.Errorf("%q: coalesced", header)
+		}
+	}
+	ran := atomic.LoadInt32(&n)
+
+	var wg sync.WaitGroup
+	got := make([]*httptest.ResponseRecorder, 3)
+	for i, tenant := range []string{"a", "a", "b"} {
+		wg.Add(1)
+		go func(i int, tenant string) {
+			defer wg.Done()
+			got[i] = get(h, "X-Tenant", tenant)
+		}(i, tenant)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if w := <-first; w.Body.String() != "run 1" {
+		t.Errorf("first: %q", w.Body)
+	}
+	for i, w := range got[:2] {
+		if w.Code != 200 || w.Body.String() != "run 1" || w.Header().Get("ETag") != `"v1"` {
+			t.Errorf("%d: not replayed: %d %q %v", i, w.Code, w.Body, w.Header())
+		}
+	}
+	// the response varies on a header the waiter sent differently
+	if w := got[2]; w.Body.String() == "run 1" {
+		t.Errorf("replayed across Vary: %q", w.Body)
+	}
+	if i := atomic.LoadInt32(&n); i != ran+1 {
+		t.Errorf("ran %d times, want %d", i, ran+1)
+	}
+}
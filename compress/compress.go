@@ -23,7 +23,6 @@ const (
 	contentRange     = "Content-Range"
 	contentType      = "Content-Type"
 	transferEncoding = "Transfer-Encoding"
-	vary             = "Vary"
 )
 
 type Options struct {
@@ -42,11 +41,18 @@ func Pull(ctx *tiny.Context) bool {
 }
 
 func On(ctx *tiny.Context) {
-	ctx.Values[keyCompress] = true
+	set(ctx, true)
 }
 
 func Off(ctx *tiny.Context) {
-	ctx.Values[keyCompress] = false
+	set(ctx, false)
+}
+
+func set(ctx *tiny.Context, b bool) {
+	if ctx.Values == nil {
+		ctx.Values = make(map[interface{}]interface{}, 10)
+	}
+	ctx.Values[keyCompress] = b
 }
 
 func New(o *Options) tiny.HandlerFunc {
@@ -70,12 +76,11 @@ func New(o *Options) tiny.HandlerFunc {
 		}
 		ctx.ResponseWriter = rw
 		On(ctx)
-		defer func() {
+		ctx.OnFinish(func() {
 			if rw.flag == 1 {
 				log.ErrError(rw.wc.Close())
 			}
-		}()
-		ctx.Next()
+		})
 	}
 }
 
@@ -110,7 +115,8 @@ func allowedContentType(c string) bool {
 		}
 	}
 	if c == "application" {
-		for _, i := range [...]string{"ogg", "x-rar-compressed", "zip", "x-gzip"} {
+		for _, i := range [...]string{"ogg", "x-rar-compressed", "zip", "x-gzip",
+			"vnd.openxmlformats-officedocument.spreadsheetml.sheet"} {
 			if t == i {
 				return false
 			}
@@ -140,7 +146,8 @@ func (rw *responseWriter) initialize(data []byte) {
 	}
 	if Pull(rw.ctx) {
 		h := rw.Header()
-		if h.Get(contentEncoding) == "" && h.Get(contentRange) == "" {
+		// responses that accept byte ranges are left uncompressed
+		if h.Get(contentEncoding) == "" && h.Get(contentRange) == "" && h.Get(acceptRanges) != "bytes" {
 			ct := h.Get(contentType)
 			if h.Get(transferEncoding) == "" && ct == "" {
 				ct = http.DetectContentType(data)
@@ -150,7 +157,7 @@ func (rw *responseWriter) initialize(data []byte) {
 				h.Del(contentLength)
 				h.Del(acceptRanges)
 				h.Set(contentEncoding, rw.ce)
-				h.Set(vary, acceptEncoding)
+				rw.ctx.Vary(acceptEncoding)
 				rw.flag = 1
 				return
 			}
@@ -176,3 +183,14 @@ func (rw *responseWriter) Write(data []byte) (int, error) {
 		return rw.ResponseWriter.Write(data)
 	}
 }
+
+func (rw *responseWriter) Flush() {
+	if rw.flag == 1 {
+		if f, ok := rw.wc.(interface{ Flush() error }); ok {
+			log.ErrWarning(f.Flush())
+		}
+	}
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
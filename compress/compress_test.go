@@ -0,0 +1,98 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cxr29/tiny"
+)
+
+func TestCompress(t *testing.T) {
+	css := strings.Repeat("body { color: red }\n", 150)
+	r := new(tiny.Router)
+	r.Use(New(nil))
+	r.GET("/serve.css", func(ctx *tiny.Context) {
+		ctx.ServeContent("a.css", time.Time{}, bytes.NewReader([]byte(css)))
+	})
+	r.GET("/write.css", func(ctx *tiny.Context) {
+		ctx.Header().Set("Content-Type", "text/css")
+		ctx.WriteString(css)
+	})
+	r.GET("/off.css", func(ctx *tiny.Context) {
+		Off(ctx)
+		ctx.Header().Set("Content-Type", "text/css")
+		ctx.WriteString(css)
+	})
+	r.GET("/a.png", func(ctx *tiny.Context) {
+		ctx.Header().Set("Content-Type", "image/png")
+		ctx.WriteString(css)
+	})
+	r.GET("/a.xlsx", func(ctx *tiny.Context) {
+		ctx.ContentTypeXLSX()
+		ctx.WriteString(css)
+	})
+	h := r.Handler()
+	for _, c := range []struct {
+		path, rng, encoding string
+		status              int
+		gzip                bool
+	}{
+		{"/serve.css", "", "gzip", 200, false},
+		{"/serve.css", "bytes=0-9", "gzip", 206, false},
+		{"/write.css", "", "gzip", 200, true},
+		{"/write.css", "", "", 200, false},
+		{"/off.css", "", "gzip", 200, false},
+		{"/a.png", "", "gzip", 200, false},
+		{"/a.xlsx", "", "gzip", 200, false},
+	} {
+		req := httptest.NewRequest("GET", c.path, nil)
+		if c.encoding != "" {
+			req.Header.Set("Accept-Encoding", c.encoding)
+		}
+		if c.rng != "" {
+			req.Header.Set("Range", c.rng)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != c.status {
+			t.Errorf("%s %s: status %d, want %d", c.path, c.rng, w.Code, c.status)
+			continue
+		}
+		if got := w.Header().Get("Content-Encoding") == "gzip"; got != c.gzip {
+			t.Errorf("%s %s: gzip %v, want %v", c.path, c.rng, got, c.gzip)
+			continue
+		}
+		body := w.Body.String()
+		if c.gzip {
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, _ := io.ReadAll(zr)
+			body = string(p)
+			if w.Header().Get("Accept-Ranges") != "" || w.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("%s: header %v", c.path, w.Header())
+			}
+		}
+		switch {
+		case c.status == 206:
+			if body != css[:10] {
+				t.Errorf("%s %s: got %q", c.path, c.rng, body)
+			}
+		case body != css:
+			t.Errorf("%s: body differs", c.path)
+		}
+		if c.path == "/serve.css" && w.Header().Get("Accept-Ranges") != "bytes" {
+			t.Errorf("%s %s: Accept-Ranges dropped", c.path, c.rng)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// scan the next entity-tag of an If-Match or If-None-Match list
+func scanETag(s string) (etag, rest string) {
+	s = strings.TrimLeft(s, " \t,")
+	if s == "" {
+		return
+	}
+	start := 0
+	if strings.HasPrefix(s, "W/") {
+		start = 2
+	}
+	if len(s)-start < 2 || s[start] != '"' {
+		if i := strings.IndexByte(s, ','); i >= 0 {
+			return "", s[i:]
+		}
+		return
+	}
+	for i := start + 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			return s[:i+1], s[i+1:]
+		case c == 0x21 || c >= 0x23 && c <= 0x7e || c >= 0x80:
+		default:
+			return
+		}
+	}
+	return
+}
+
+func isWeak(etag string) bool {
+	return strings.HasPrefix(etag, "W/")
+}
+
+func strongMatch(a, b string) bool {
+	return a == b && a != "" && !isWeak(a) && !isWeak(b)
+}
+
+func weakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+func matchETag(header, etag string, match func(a, b string) bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return etag != ""
+	}
+	for s := header; ; {
+		var t string
+		if t, s = scanETag(s); t == "" {
+			if s == "" {
+				return false
+			}
+			continue
+		}
+		if etag != "" && match(t, etag) {
+			return true
+		}
+	}
+}
+
+func isGetOrHead(method string) bool {
+	return method == "GET" || method == "HEAD"
+}
+
+// RFC 9110 section 13.2.2, 0 means the request should be processed
+func evaluatePreconditions(r *http.Request, etag string, modTime time.Time) int {
+	modTime = modTime.Truncate(time.Second)
+	if v := r.Header.Get("If-Match"); v != "" {
+		if !matchETag(v, etag, strongMatch) {
+			return http.StatusPreconditionFailed
+		}
+	} else if v := r.Header.Get("If-Unmodified-Since"); v != "" && !modTime.IsZero() {
+		if t, err := http.ParseTime(v); err == nil && modTime.After(t) {
+			return http.StatusPreconditionFailed
+		}
+	}
+	if v := r.Header.Get("If-None-Match"); v != "" {
+		if matchETag(v, etag, weakMatch) {
+			if isGetOrHead(r.Method) {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if v := r.Header.Get("If-Modified-Since"); v != "" && !modTime.IsZero() && isGetOrHead(r.Method) {
+		if t, err := http.ParseTime(v); err == nil && !modTime.After(t) {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+func dropContentHeaders(h http.Header) {
+	delete(h, "Content-Type")
+	delete(h, "Content-Length")
+	delete(h, "Content-Encoding")
+}
+
+func (ctx *Context) CheckPreconditions(etag string, modTime time.Time) bool {
+	if isGetOrHead(ctx.Request.Method) {
+		if etag != "" {
+			ctx.ETag(etag)
+		}
+		if !modTime.IsZero() {
+			ctx.LastModified(modTime)
+		}
+	}
+	switch evaluatePreconditions(ctx.Request, etag, modTime) {
+	case http.StatusNotModified:
+		dropContentHeaders(ctx.Header())
+		ctx.NotModified()
+		return false
+	case http.StatusPreconditionFailed:
+		ctx.errorStatus(http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+func NewETag(limit int) Handler {
+	return HandlerFunc(func(ctx *Context) {
+		if !isGetOrHead(ctx.Request.Method) {
+			return
+		}
+		b := ctx.Buffer(limit)
+		ctx.OnFinish(func() {
+			if ctx.Panicked() || b.Spilled() || b.code != http.StatusOK && b.code != 0 ||
+				b.Len() == 0 || ctx.IsAborted() {
+				return
+			}
+			h := ctx.Header()
+			etag := h.Get("ETag")
+			if etag == "" {
+				sum := sha256.Sum256(b.Bytes())
+				etag = `"` + base64.RawURLEncoding.EncodeToString(sum[:18]) + `"`
+				h.Set("ETag", etag)
+			}
+			modTime, _ := http.ParseTime(h.Get("Last-Modified"))
+			switch evaluatePreconditions(ctx.Request, etag, modTime) {
+			case http.StatusNotModified:
+				b.buf.Reset()
+				b.code = http.StatusNotModified
+				ctx.status = http.StatusNotModified
+				ctx.written = 0
+				dropContentHeaders(h)
+			case http.StatusPreconditionFailed:
+				b.Reset()
+				ctx.errorStatus(http.StatusPreconditionFailed)
+			}
+		})
+	})
+}
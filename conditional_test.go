@@ -0,0 +1,139 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestScanETag(t *testing.T) {
+	var got []string
+	for s := ` "a", W/"b" ,bad, "c`; s != ""; {
+		var etag string
+		etag, s = scanETag(s)
+		got = append(got, etag)
+	}
+	want := []string{`"a"`, `W/"b"`, "", ""}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestPreconditions(t *testing.T) {
+	mod := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	before := mod.Add(-time.Hour).Format(http.TimeFormat)
+	at := mod.Format(http.TimeFormat)
+	for _, c := range []struct {
+		method, header, value string
+		want                  int
+	}{
+		{"GET", "", "", 0},
+		{"PUT", "If-Match", `"v1"`, 0},
+		{"PUT", "If-Match", `"v1", "v2"`, 0},
+		{"PUT", "If-Match", `*`, 0},
+		{"PUT", "If-Match", `"v2"`, 412},
+		{"PUT", "If-Match", `W/"v1"`, 412},
+		{"GET", "If-None-Match", `"v1"`, 304},
+		{"GET", "If-None-Match", `W/"v1"`, 304},
+		{"HEAD", "If-None-Match", `*`, 304},
+		{"GET", "If-None-Match", `"v2"`, 0},
+		{"POST", "If-None-Match", `"v1"`, 412},
+		{"GET", "If-Modified-Since", at, 304},
+		{"GET", "If-Modified-Since", before, 0},
+		{"POST", "If-Modified-Since", at, 0},
+		{"PUT", "If-Unmodified-Since", before, 412},
+		{"PUT", "If-Unmodified-Since", at, 0},
+		{"GET", "If-Modified-Since", "garbage", 0},
+	} {
+		r := httptest.NewRequest(c.method, "/", nil)
+		if c.header != "" {
+			r.Header.Set(c.header, c.value)
+		}
+		if got := evaluatePreconditions(r, `"v1"`, mod.Add(time.Millisecond)); got != c.want {
+			t.Errorf("%s %s: %s: got %d, want %d", c.method, c.header, c.value, got, c.want)
+		}
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("If-None-Match", `"v2"`)
+	r.Header.Set("If-Modified-Since", at)
+	if got := evaluatePreconditions(r, `"v1"`, mod); got != 0 {
+		t.Errorf("got %d", got)
+	}
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	mod := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	r := new(Router)
+	r.GET("/", func(ctx *Context) {
+		if ctx.CheckPreconditions(`"v1"`, mod) {
+			ctx.WriteString("body")
+		}
+	})
+	r.PUT("/", func(ctx *Context) {
+		if ctx.CheckPreconditions(`"v1"`, mod) {
+			ctx.WriteString("updated")
+		}
+	})
+	h := r.Handler()
+	for _, c := range []struct {
+		method, header, value string
+		status                int
+		body                  string
+	}{
+		{"GET", "", "", 200, "body"},
+		{"GET", "If-None-Match", `"v1"`, 304, ""},
+		{"PUT", "If-Match", `"v1"`, 200, "updated"},
+		{"PUT", "If-Match", `"v0"`, 412, ""},
+	} {
+		req := httptest.NewRequest(c.method, "/", nil)
+		if c.header != "" {
+			req.Header.Set(c.header, c.value)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != c.status || c.body != "" && w.Body.String() != c.body {
+			t.Errorf("%s %s: got %d %q", c.method, c.header, w.Code, w.Body)
+		}
+		if c.method == "GET" && (w.Header().Get("ETag") != `"v1"` || w.Header().Get("Last-Modified") == "") {
+			t.Errorf("%s %s: validators not set: %v", c.method, c.header, w.Header())
+		}
+		if c.status == 304 && w.Header().Get("Content-Type") != "" {
+			t.Errorf("content type on 304: %v", w.Header())
+		}
+	}
+}
+
+func TestNewETag(t *testing.T) {
+	r := new(Router)
+	r.Use(NewETag(1 << 10))
+	r.GET("/", func(ctx *Context) {
+		ctx.WriteString("body")
+	})
+	h := r.Handler()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != 200 || etag == "" || w.Body.String() != "body" {
+		t.Fatalf("got %d %q %v", w.Code, w.Body, w.Header())
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != 304 || w.Body.Len() != 0 || w.Header().Get("Content-Length") != "" {
+		t.Errorf("got %d %q %v", w.Code, w.Body, w.Header())
+	}
+}
@@ -8,10 +8,12 @@ import (
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cxr29/log"
@@ -55,10 +57,16 @@ func (ctx *Context) IsAJAX() bool {
 }
 
 func (ctx *Context) writeError(s string) (int, error) {
-	if ctx.IsAJAX() {
-		return ctx.WriteJSON(map[string]string{"Error": s})
+	var p []byte
+	ctx.Vary("Accept")
+	if ctx.IsAJAX() || ctx.Negotiate(mimePlain, mimeJSON) == mimeJSON {
+		ctx.ContentTypeJSON()
+		p, _ = json.Marshal(map[string]string{"Error": s})
+	} else {
+		ctx.ContentTypePlain()
+		p = []byte("Error: " + s)
 	}
-	return ctx.WritePlain("Error: " + s)
+	return ctx.Write(p)
 }
 
 func (ctx *Context) WriteError(e interface{}) (int, error) {
@@ -83,6 +91,14 @@ func (ctx *Context) ServeFile(name string) {
 	http.ServeFile(ctx, ctx.Request, name)
 }
 
+func (ctx *Context) ServeContent(name string, modTime time.Time, content io.ReadSeeker) {
+	http.ServeContent(ctx, ctx.Request, name, modTime, content)
+}
+
+func (ctx *Context) ServeReaderAt(name string, modTime time.Time, r io.ReaderAt, size int64) {
+	http.ServeContent(ctx, ctx.Request, name, modTime, io.NewSectionReader(r, 0, size))
+}
+
 func (ctx *Context) ContentLength(i int) {
 	ctx.Header().Set("Content-Length", strconv.Itoa(i))
 }
@@ -115,6 +131,14 @@ func (ctx *Context) ContentTypeCSV() {
 	ctx.utf8ContentType("text/csv")
 }
 
+func (ctx *Context) ContentTypeMsgPack() {
+	ctx.ContentType(mimeMsgPack)
+}
+
+func (ctx *Context) ContentTypeCBOR() {
+	ctx.ContentType(mimeCBOR)
+}
+
 func (ctx *Context) ContentTypeXLSX() {
 	ctx.ContentType("application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
 }
@@ -123,13 +147,13 @@ const filenameLength = 255
 
 var filenameRegexp = regexp.MustCompile(`^[-.0-9A-Z_a-z]+$`)
 
-func (ctx *Context) ContentDisposition(filename, fallback string) {
+func (ctx *Context) contentDisposition(typ, filename, fallback string) {
 	if len(filename) == 0 || len(filename) > filenameLength {
 		panic("malformed filename")
 	} else if filenameRegexp.MatchString(filename) {
-		filename = "attachment; filename=" + filename
+		filename = typ + "; filename=" + filename
 	} else {
-		filename = "attachment; filename*=UTF-8''" + url.QueryEscape(filename)
+		filename = typ + "; filename*=UTF-8''" + strings.Replace(url.QueryEscape(filename), "+", "%20", -1)
 		if len(fallback) > 0 {
 			if len(fallback) > filenameLength || !filenameRegexp.MatchString(fallback) {
 				panic("malformed fallback")
@@ -140,6 +164,14 @@ func (ctx *Context) ContentDisposition(filename, fallback string) {
 	ctx.Header().Set("Content-Disposition", filename)
 }
 
+func (ctx *Context) ContentDisposition(filename, fallback string) {
+	ctx.contentDisposition("attachment", filename, fallback)
+}
+
+func (ctx *Context) ContentDispositionInline(filename, fallback string) {
+	ctx.contentDisposition("inline", filename, fallback)
+}
+
 func (ctx *Context) MaxAge(seconds int) {
 	v := time.Now().Add(time.Duration(seconds) * time.Second).Format(http.TimeFormat)
 	h := ctx.Header()
@@ -159,8 +191,8 @@ func (ctx *Context) LastModified(t time.Time) {
 }
 
 func (ctx *Context) IfModifiedSince(t time.Time) bool {
-	v, _ := http.ParseTime(ctx.Request.Header.Get("If-Modified-Since"))
-	return v.IsZero() || v.Unix() != t.Unix()
+	v, err := http.ParseTime(ctx.Request.Header.Get("If-Modified-Since"))
+	return err != nil || t.Truncate(time.Second).After(v)
 }
 
 func (ctx *Context) ETag(s string) {
@@ -169,15 +201,15 @@ func (ctx *Context) ETag(s string) {
 
 func (ctx *Context) IfNoneMatch(s string) bool {
 	v := ctx.Request.Header.Get("If-None-Match")
-	return v == "" || v != s
+	return v == "" || !matchETag(v, s, weakMatch)
 }
 
 func (ctx *Context) MovedPermanently(location string) {
-	http.Redirect(ctx, ctx.Request, location, http.StatusMovedPermanently)
+	ctx.Redirect(location, http.StatusMovedPermanently)
 }
 
 func (ctx *Context) Found(location string) {
-	http.Redirect(ctx, ctx.Request, location, http.StatusFound)
+	ctx.Redirect(location, http.StatusFound)
 }
 
 func (ctx *Context) NotModified() {
@@ -185,7 +217,7 @@ func (ctx *Context) NotModified() {
 }
 
 func (ctx *Context) errorStatus(code int) {
-	http.Error(ctx, http.StatusText(code), code)
+	ctx.WriteProblem(NewProblem(code, ""))
 }
 
 func (ctx *Context) BadRequest() {
@@ -22,36 +22,94 @@ type Context struct {
 	wroteHeader   bool
 	written       int64
 	status, index int
+	aborted       bool
+	panicked      bool
+	headerHooks   []func()
+	finishHooks   []func()
+	buffer        *Buffer
+	page          *Problem
 }
 
 func (ctx *Context) Routed() bool {
 	return ctx.node != nil
 }
 
+func (ctx *Context) Tree() *Tree {
+	return ctx.tree
+}
+
 func (ctx *Context) call(i int) {
+	if ctx.aborted {
+		return
+	}
 	var h Handler
 	if j := i - len(ctx.tree.handlers); j < 0 {
-		h = ctx.tree.handlers[i]
+		if ctx.Routed() && ctx.node.globals != nil {
+			h = ctx.node.globals[i]
+		} else {
+			h = ctx.tree.handlers[i]
+		}
 	} else if ctx.Routed() && j < len(ctx.node.handlers) {
 		h = ctx.node.handlers[j]
 	} else {
 		return
 	}
-	h.ServeHTTP(ctx)
-	if ctx.index == i && !ctx.wroteHeader {
+	if h != nil {
+		h.ServeHTTP(ctx)
+	}
+	if ctx.index == i && !ctx.wroteHeader && !ctx.aborted {
 		ctx.Next()
 	}
 }
 
 func (ctx *Context) Next() {
+	if ctx.aborted {
+		return
+	}
 	ctx.index++
 	ctx.call(ctx.index)
 }
 
+func (ctx *Context) Abort() {
+	ctx.aborted = true
+}
+
+func (ctx *Context) IsAborted() bool {
+	return ctx.aborted
+}
+
+func (ctx *Context) Panicked() bool {
+	return ctx.panicked
+}
+
+func (ctx *Context) OnWriteHeader(f func()) {
+	ctx.headerHooks = append(ctx.headerHooks, f)
+}
+
+func (ctx *Context) OnFinish(f func()) {
+	ctx.finishHooks = append(ctx.finishHooks, f)
+}
+
+func (ctx *Context) finish() {
+	err := recover()
+	if err != nil {
+		ctx.panicked = true
+	}
+	for i := len(ctx.finishHooks) - 1; i >= 0; i-- {
+		ctx.finishHooks[i]()
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
 func (ctx *Context) WriteHeader(code int) {
 	if !ctx.wroteHeader {
 		ctx.wroteHeader = true
 		ctx.status = code
+		for _, f := range ctx.headerHooks {
+			f()
+		}
 	}
 	ctx.ResponseWriter.WriteHeader(code)
 }
@@ -64,7 +122,7 @@ func (ctx *Context) Write(data []byte) (int, error) {
 		if h.Get("Transfer-Encoding") == "" && h.Get(contentType) == "" {
 			h.Set(contentType, http.DetectContentType(data))
 		}
-		ctx.WriteHeader(http.StatusOK)
+		ctx.WriteHeader(ctx.implicitStatus())
 	}
 	n, err := ctx.ResponseWriter.Write(data)
 	log.ErrWarning(err)
@@ -72,6 +130,15 @@ func (ctx *Context) Write(data []byte) (int, error) {
 	return n, err
 }
 
+func (ctx *Context) Flush() {
+	if f, ok := ctx.ResponseWriter.(http.Flusher); ok {
+		if !ctx.wroteHeader {
+			ctx.WriteHeader(http.StatusOK)
+		}
+		f.Flush()
+	}
+}
+
 func (ctx *Context) WroteHeader() bool {
 	return ctx.wroteHeader
 }
@@ -84,6 +151,27 @@ func (ctx *Context) Status() int {
 	return ctx.status
 }
 
+func (ctx *Context) Pattern() string {
+	if ctx.Routed() {
+		return ctx.node.pattern
+	}
+	return ""
+}
+
+func (ctx *Context) RouteName() string {
+	if ctx.Routed() {
+		return ctx.node.name
+	}
+	return ""
+}
+
+func (ctx *Context) ParamNames() []string {
+	if ctx.Routed() {
+		return ctx.node.params
+	}
+	return nil
+}
+
 func (ctx *Context) Param(name string) string {
 	if ctx.Routed() {
 		for i := len(ctx.node.params) - 1; i >= 0; i-- {
@@ -0,0 +1,113 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"encoding/csv"
+	"strconv"
+)
+
+type CSVOptions struct {
+	Comma      rune
+	BOM        bool // for Excel
+	UseCRLF    bool
+	FlushEvery int  // rows, no periodic flush if zero
+	Escape     bool // prefix cells that may be read as formulas with a quote
+}
+
+var DefaultCSVOptions = &CSVOptions{
+	Comma:      ',',
+	FlushEvery: 100,
+	Escape:     true,
+}
+
+type CSVWriter struct {
+	ctx *Context
+	o   *CSVOptions
+	w   *csv.Writer
+	n   int
+}
+
+func (ctx *Context) CSV(filename string, header []string) *CSVWriter {
+	return ctx.CSVWith(DefaultCSVOptions, filename, header)
+}
+
+func (ctx *Context) TSV(filename string, header []string) *CSVWriter {
+	o := *DefaultCSVOptions
+	o.Comma = '\t'
+	return ctx.CSVWith(&o, filename, header)
+}
+
+func (ctx *Context) CSVWith(o *CSVOptions, filename string, header []string) *CSVWriter {
+	if o == nil {
+		o = DefaultCSVOptions
+	}
+	if o.Comma == '\t' {
+		ctx.utf8ContentType("text/tab-separated-values")
+	} else {
+		ctx.ContentTypeCSV()
+	}
+	if filename != "" {
+		ctx.ContentDisposition(filename, "")
+	}
+	w := &CSVWriter{ctx: ctx, o: o, w: csv.NewWriter(ctx)}
+	w.w.Comma = o.Comma
+	w.w.UseCRLF = o.UseCRLF
+	ctx.OnFinish(func() {
+		if !ctx.Panicked() {
+			w.w.Flush()
+		}
+	})
+	if o.BOM {
+		ctx.WriteString("\xef\xbb\xbf")
+	}
+	if header != nil {
+		w.Write(header)
+	}
+	return w
+}
+
+// OWASP CSV injection
+func escapeFormula(s string) string {
+	if s == "" {
+		return s
+	}
+	switch s[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return "'" + s
+		}
+	}
+	return s
+}
+
+func (w *CSVWriter) Write(record []string) error {
+	if err := w.ctx.Request.Context().Err(); err != nil {
+		return err
+	}
+	if w.o.Escape {
+		a := make([]string, len(record))
+		for i, s := range record {
+			a[i] = escapeFormula(s)
+		}
+		record = a
+	}
+	if err := w.w.Write(record); err != nil {
+		return err
+	}
+	if w.n++; w.o.FlushEvery > 0 && w.n%w.o.FlushEvery == 0 {
+		return w.Flush()
+	}
+	return nil
+}
+
+func (w *CSVWriter) Flush() error {
+	w.w.Flush()
+	if err := w.w.Error(); err != nil {
+		return err
+	}
+	w.ctx.Flush()
+	return nil
+}
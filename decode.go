@@ -0,0 +1,241 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/cxr29/tiny/validate"
+)
+
+const (
+	mimeForm      = "application/x-www-form-urlencoded"
+	mimeMultipart = "multipart/form-data"
+)
+
+type Decoder func(r io.Reader, v interface{}) error
+
+type decoder struct {
+	mediaType string
+	decode    Decoder
+}
+
+var decoders []decoder
+
+func RegisterDecoder(mediaType string, dec Decoder) {
+	if dec == nil {
+		panic("nil decoder")
+	}
+	mediaType = strings.ToLower(mediaType)
+	for i := range decoders {
+		if decoders[i].mediaType == mediaType {
+			decoders[i].decode = dec
+			return
+		}
+	}
+	decoders = append(decoders, decoder{mediaType, dec})
+}
+
+type DecodeOptions struct {
+	MaxBodySize           int64
+	MaxMemory             int64
+	DisallowUnknownFields bool
+}
+
+var DefaultDecodeOptions = &DecodeOptions{
+	MaxBodySize:           10 << 20,
+	MaxMemory:             32 << 20,
+	DisallowUnknownFields: true,
+}
+
+type DecodeError struct {
+	Status int
+	Field  string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Field != "" {
+		return e.Field + ": " + e.Err.Error()
+	}
+	return e.Err.Error()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DecodeError) StatusCode() int {
+	return e.Status
+}
+
+var (
+	ErrEmptyBody            = errors.New("empty body")
+	ErrTrailingData         = errors.New("trailing data after body")
+	ErrBodyTooLarge         = errors.New("body too large")
+	ErrUnsupportedMediaType = errors.New("unsupported media type")
+)
+
+func badRequest(field string, err error) *DecodeError {
+	return &DecodeError{http.StatusBadRequest, field, err}
+}
+
+func acceptedMediaTypes() []string {
+	a := []string{mimeJSON, mimeXML, mimeForm, mimeMultipart}
+	for _, d := range decoders {
+		a = append(a, d.mediaType)
+	}
+	return a
+}
+
+func (ctx *Context) Decode(v interface{}) error {
+	return ctx.DecodeWith(nil, v)
+}
+
+func (ctx *Context) DecodeWith(o *DecodeOptions, v interface{}) error {
+	if o == nil {
+		o = DefaultDecodeOptions
+	}
+	r := ctx.Request
+	if o.MaxBodySize > 0 {
+		if r.ContentLength > o.MaxBodySize {
+			return &DecodeError{http.StatusRequestEntityTooLarge, "", ErrBodyTooLarge}
+		}
+		r.Body = http.MaxBytesReader(ctx, r.Body, o.MaxBodySize)
+	}
+	t, _, err := mime.ParseMediaType(r.Header.Get(contentType))
+	if err != nil {
+		t = ""
+	}
+	switch {
+	case t == mimeJSON || strings.HasSuffix(t, "+json"):
+		err = decodeJSON(r.Body, v, o.DisallowUnknownFields)
+	case t == mimeXML || t == "text/xml" || strings.HasSuffix(t, "+xml"):
+		err = decodeXML(r.Body, v)
+	case t == mimeForm:
+		if err = r.ParseForm(); err == nil {
+			err = decodeForm(v, r.PostForm, nil, o.DisallowUnknownFields)
+		} else {
+			err = badRequest("", err)
+		}
+	case t == mimeMultipart:
+		if err = r.ParseMultipartForm(o.MaxMemory); err == nil {
+			err = decodeForm(v, r.MultipartForm.Value, r.MultipartForm.File, o.DisallowUnknownFields)
+		} else {
+			err = badRequest("", err)
+		}
+	default:
+		var dec Decoder
+		for _, d := range decoders {
+			if d.mediaType == t {
+				dec = d.decode
+				break
+			}
+		}
+		if dec != nil {
+			err = dec(r.Body, v)
+		} else {
+			err = ctx.unsupportedMediaType(t)
+		}
+	}
+	if err != nil {
+		return decodeError(err)
+	}
+	return validate.Struct(v)
+}
+
+func (ctx *Context) unsupportedMediaType(t string) error {
+	s := strings.Join(acceptedMediaTypes(), ", ")
+	switch ctx.Request.Method {
+	case "POST":
+		ctx.Header().Set("Accept-Post", s)
+	case "PATCH":
+		ctx.Header().Set("Accept-Patch", s)
+	}
+	if t == "" {
+		t = "missing content type"
+	}
+	return &DecodeError{http.StatusUnsupportedMediaType, "", fmt.Errorf("%w: %s", ErrUnsupportedMediaType, t)}
+}
+
+func decodeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var de *DecodeError
+	var mbe *http.MaxBytesError
+	var se *json.SyntaxError
+	var te *json.UnmarshalTypeError
+	var xse *xml.SyntaxError
+	var xue xml.UnmarshalError
+	switch {
+	case errors.As(err, &mbe):
+		return &DecodeError{http.StatusRequestEntityTooLarge, "", ErrBodyTooLarge}
+	case errors.As(err, &de):
+		return de
+	case errors.As(err, &se):
+		return badRequest("", fmt.Errorf("malformed json at offset %d: %w", se.Offset, se))
+	case errors.As(err, &te):
+		return badRequest(te.Field, fmt.Errorf("cannot use %s as %s", te.Value, te.Type))
+	case errors.As(err, &xse):
+		return badRequest("", fmt.Errorf("malformed xml at line %d: %w", xse.Line, xse))
+	case errors.As(err, &xue):
+		return badRequest("", err)
+	case err == io.EOF:
+		return badRequest("", ErrEmptyBody)
+	case err == io.ErrUnexpectedEOF:
+		return badRequest("", err)
+	}
+	const unknownField = "json: unknown field "
+	if s := err.Error(); strings.HasPrefix(s, unknownField) {
+		return badRequest(strings.Trim(s[len(unknownField):], `"`), errors.New("unknown field"))
+	}
+	return err
+}
+
+func decodeJSON(r io.Reader, v interface{}, strict bool) error {
+	d := json.NewDecoder(r)
+	if strict {
+		d.DisallowUnknownFields()
+	}
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return badRequest("", ErrTrailingData)
+	}
+	return nil
+}
+
+func decodeXML(r io.Reader, v interface{}) error {
+	d := xml.NewDecoder(r)
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		switch t := t.(type) {
+		case xml.Comment, xml.ProcInst:
+			continue
+		case xml.CharData:
+			if len(strings.TrimSpace(string(t))) == 0 {
+				continue
+			}
+		}
+		return badRequest("", ErrTrailingData)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type decodeItem struct {
+	Name  string `json:"name" xml:"name" form:"name"`
+	Count int    `json:"count" xml:"count" form:"count"`
+}
+
+func serveDecode(o *DecodeOptions, method, contentType, body string, v interface{}) (error, http.Header) {
+	var err error
+	r := new(Router)
+	r.Handle(method, "/", func(ctx *Context) {
+		err = ctx.DecodeWith(o, v)
+	})
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, req)
+	return err, w.Header()
+}
+
+func TestDecode(t *testing.T) {
+	RegisterDecoder("application/x-test", func(r io.Reader, v interface{}) error {
+		p, err := io.ReadAll(r)
+		v.(*decodeItem).Name = string(p)
+		return err
+	})
+	for _, c := range []struct {
+		contentType, body string
+		want              decodeItem
+	}{
+		{"application/json", `{"name":"a","count":1}`, decodeItem{"a", 1}},
+		{"application/problem+json; charset=utf-8", `{"name":"a"} `, decodeItem{"a", 0}},
+		{"application/xml", `<item><name>a</name><count>2</count></item><!-- end -->`, decodeItem{"a", 2}},
+		{"application/x-www-form-urlencoded", `name=a&count=3`, decodeItem{"a", 3}},
+		{"application/x-test", `raw`, decodeItem{"raw", 0}},
+	} {
+		var v decodeItem
+		err, h := serveDecode(nil, "POST", c.contentType, c.body, &v)
+		if err != nil {
+			t.Errorf("%s: %v", c.contentType, err)
+		} else if v != c.want {
+			t.Errorf("%s: got %+v, want %+v", c.contentType, v, c.want)
+		}
+		if h.Get("Accept-Post") != "" {
+			t.Errorf("%s: Accept-Post set", c.contentType)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	small := &DecodeOptions{MaxBodySize: 8}
+	for _, c := range []struct {
+		o                         *DecodeOptions
+		method, contentType, body string
+		status                    int
+		field                     string
+		err                       error
+	}{
+		{nil, "POST", "application/json", `{"name":`, 400, "", nil},
+		{nil, "POST", "application/json", ``, 400, "", ErrEmptyBody},
+		{nil, "POST", "application/json", `{"name":"a"} {}`, 400, "", ErrTrailingData},
+		{nil, "POST", "application/json", `{"name":"a","x":1}`, 400, "x", nil},
+		{nil, "POST", "application/json", `{"count":"1"}`, 400, "count", nil},
+		{nil, "POST", "application/xml", `<item><name>a</item>`, 400, "", nil},
+		{nil, "POST", "application/xml", `<item></item><item></item>`, 400, "", ErrTrailingData},
+		{small, "POST", "application/json", `{"name":"abcdef"}`, 413, "", ErrBodyTooLarge},
+		{nil, "POST", "text/plain", `a`, 415, "", ErrUnsupportedMediaType},
+		{nil, "PATCH", "", `a`, 415, "", ErrUnsupportedMediaType},
+	} {
+		var v decodeItem
+		err, h := serveDecode(c.o, c.method, c.contentType, c.body, &v)
+		var de *DecodeError
+		if !errors.As(err, &de) {
+			t.Errorf("%s %s: got %v, want DecodeError", c.contentType, c.body, err)
+			continue
+		}
+		if de.StatusCode() != c.status || de.Field != c.field || c.err != nil && !errors.Is(err, c.err) {
+			t.Errorf("%s %s: got %d %q %v, want %d %q %v", c.contentType, c.body, de.Status, de.Field, de.Err, c.status, c.field, c.err)
+		}
+		accept := h.Get("Accept-Post") + h.Get("Accept-Patch")
+		if c.status == 415 && !strings.Contains(accept, "application/json") {
+			t.Errorf("%s %s: accepted %q", c.method, c.contentType, accept)
+		} else if c.status != 415 && accept != "" {
+			t.Errorf("%s %s: accepted %q", c.method, c.contentType, accept)
+		}
+	}
+}
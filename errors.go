@@ -0,0 +1,121 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cxr29/log"
+)
+
+type HTTPError struct {
+	Code    int
+	Message string
+	Err     error
+}
+
+func NewHTTPError(code int, message string, err error) *HTTPError {
+	if message == "" {
+		message = http.StatusText(code)
+	}
+	return &HTTPError{code, message, err}
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+func (e *HTTPError) StatusCode() int {
+	return e.Code
+}
+
+type ErrorHandler func(*Context, error)
+
+func (r *Router) OnError(f func(*Context, error)) {
+	r.onError = f
+}
+
+func (r *Router) errorHandler() ErrorHandler {
+	for {
+		if r.onError != nil {
+			return r.onError
+		}
+		if r.above == nil {
+			return nil
+		}
+		r = r.above.above
+	}
+}
+
+func StatusCode(err error) int {
+	var i interface{ StatusCode() int }
+	if errors.As(err, &i) {
+		if code := i.StatusCode(); code >= 400 && code <= 599 {
+			return code
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+func DefaultErrorHandler(ctx *Context, err error) {
+	code := StatusCode(err)
+	if code >= 500 {
+		log.Errorln(err)
+	}
+	if ctx.WroteHeader() && !ctx.resetBuffer() {
+		if code < 500 {
+			log.Warningln(err)
+		}
+		return
+	}
+	var p *Problem
+	var list interface {
+		Unwrap() []error
+		StatusCode() int
+	}
+	var he *HTTPError
+	switch {
+	case errors.As(err, &p):
+	case code < 500 && errors.As(err, &list):
+		p = NewProblem(code, "")
+		p.Extensions = map[string]interface{}{"errors": list}
+	case errors.As(err, &he):
+		p = NewProblem(code, "")
+		if he.Message != http.StatusText(code) {
+			p.Detail = he.Message
+		}
+	case code >= 500:
+		p = NewProblem(code, "")
+	default:
+		p = NewProblem(code, err.Error())
+	}
+	ctx.WriteProblem(p)
+}
+
+func (ctx *Context) Error(err error) {
+	if err == nil {
+		return
+	}
+	ctx.Abort()
+	var f ErrorHandler
+	if ctx.Routed() {
+		f = ctx.node.onError
+	}
+	if f == nil {
+		f = ctx.tree.onError
+	}
+	if f == nil {
+		f = DefaultErrorHandler
+	}
+	f(ctx, err)
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"encoding"
+	"errors"
+	"mime/multipart"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	typeDuration        = reflect.TypeOf(time.Duration(0))
+	typeFileHeader      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	typeTextUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	typeTime            = reflect.TypeOf(time.Time{})
+)
+
+func tagName(f reflect.StructField, key string) string {
+	s := f.Tag.Get(key)
+	if i := strings.IndexByte(s, ','); i >= 0 {
+		s = s[:i]
+	}
+	switch s {
+	case "-":
+		return ""
+	case "":
+		return f.Name
+	}
+	return s
+}
+
+func decodeForm(v interface{}, values map[string][]string, files map[string][]*multipart.FileHeader, strict bool) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("decode form into non-pointer to struct")
+	}
+	used := make(map[string]bool, len(values)+len(files))
+	if err := decodeFormStruct(rv.Elem(), values, files, used); err != nil {
+		return err
+	}
+	if strict {
+		for k := range values {
+			if !used[k] {
+				return badRequest(k, errors.New("unknown field"))
+			}
+		}
+		for k := range files {
+			if !used[k] {
+				return badRequest(k, errors.New("unknown field"))
+			}
+		}
+	}
+	return nil
+}
+
+func decodeFormStruct(rv reflect.Value, values map[string][]string, files map[string][]*multipart.FileHeader, used map[string]bool) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		fv := rv.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if _, ok := f.Tag.Lookup("form"); !ok {
+				if err := decodeFormStruct(fv, values, files, used); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		name := tagName(f, "form")
+		if name == "" {
+			continue
+		}
+		switch f.Type {
+		case typeFileHeader:
+			if a := files[name]; len(a) > 0 {
+				used[name] = true
+				fv.Set(reflect.ValueOf(a[0]))
+			}
+			continue
+		case reflect.SliceOf(typeFileHeader):
+			if a := files[name]; len(a) > 0 {
+				used[name] = true
+				fv.Set(reflect.ValueOf(a))
+			}
+			continue
+		}
+		if a, ok := values[name]; ok {
+			used[name] = true
+			if err := setValues(fv, a, f.Tag.Get("layout")); err != nil {
+				return badRequest(name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func setValues(v reflect.Value, a []string, layout string) error {
+	if len(a) == 0 {
+		return nil
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 &&
+		!reflect.PtrTo(v.Type()).Implements(typeTextUnmarshaler) {
+		s := reflect.MakeSlice(v.Type(), len(a), len(a))
+		for i := range a {
+			if err := setValue(s.Index(i), a[i], layout); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	return setValue(v, a[0], layout)
+}
+
+func setValue(v reflect.Value, s, layout string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setValue(v.Elem(), s, layout)
+	}
+	switch v.Type() {
+	case typeTime:
+		if layout != "" {
+			t, err := time.Parse(layout, s)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(t))
+			return nil
+		}
+	case typeDuration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	if v.CanAddr() {
+		if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return u.UnmarshalText([]byte(s))
+		}
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return numError(err)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return numError(err)
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return numError(err)
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return numError(err)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(s))
+			break
+		}
+		fallthrough
+	default:
+		return errors.New("unsupported type " + v.Type().String())
+	}
+	return nil
+}
+
+func numError(err error) error {
+	if e, ok := err.(*strconv.NumError); ok {
+		return e.Err
+	}
+	return err
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/cxr29/log"
+	"github.com/cxr29/tiny"
+)
+
+const replayed = "Idempotent-Replayed"
+
+type Options struct {
+	Store    Store
+	Header   string
+	Methods  []string
+	Required bool                       // reject requests without the key
+	MaxBytes int64                      // of the request and response bodies
+	Scope    func(*tiny.Context) string // keys are shared by requests of the same scope, nil for all
+}
+
+var DefaultOptions = &Options{
+	Store:    NewMemoryStore(24 * time.Hour),
+	Header:   "Idempotency-Key",
+	Methods:  []string{"POST", "PATCH"},
+	MaxBytes: 1 << 20,
+	Scope:    Credentials,
+}
+
+// hash of the Authorization and Cookie headers, empty without both
+func Credentials(ctx *tiny.Context) string {
+	h := ctx.Request.Header
+	a, c := h.Values("Authorization"), h.Values("Cookie")
+	if len(a) == 0 && len(c) == 0 {
+		return ""
+	}
+	sum := sha256.New()
+	for _, s := range a {
+		io.WriteString(sum, "a "+s+"\n")
+	}
+	for _, s := range c {
+		io.WriteString(sum, "c "+s+"\n")
+	}
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+func (o *Options) method(s string) bool {
+	for _, m := range o.Methods {
+		if m == s {
+			return true
+		}
+	}
+	return false
+}
+
+func fingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func New(o *Options) tiny.HandlerFunc {
+	if o == nil {
+		o = DefaultOptions
+	}
+	return func(ctx *tiny.Context) {
+		r := ctx.Request
+		if !o.method(r.Method) {
+			return
+		}
+		key := r.Header.Get(o.Header)
+		if key == "" {
+			if o.Required {
+				ctx.Error(tiny.NewHTTPError(http.StatusBadRequest, "Missing "+o.Header, nil))
+			}
+			return
+		}
+		if len(key) > 255 {
+			ctx.Error(tiny.NewHTTPError(http.StatusBadRequest, "Malformed "+o.Header, nil))
+			return
+		}
+		var body []byte
+		if r.Body != nil {
+			var err error
+			body, err = io.ReadAll(io.LimitReader(r.Body, o.MaxBytes+1))
+			r.Body.Close()
+			if err != nil {
+				ctx.Error(tiny.NewHTTPError(http.StatusBadRequest, "", err))
+				return
+			} else if int64(len(body)) > o.MaxBytes {
+				ctx.Error(tiny.NewHTTPError(http.StatusRequestEntityTooLarge, "", nil))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		if o.Scope != nil {
+			if scope := o.Scope(ctx); scope != "" {
+				key = scope + " " + key
+			}
+		}
+		fp := fingerprint(r, body)
+		rec, reserved, err := o.Store.Begin(key, fp)
+		if err != nil {
+			ctx.Error(err)
+			return
+		}
+		if !reserved {
+			switch {
+			case rec.Fingerprint != fp:
+				ctx.Error(tiny.NewHTTPError(http.StatusUnprocessableEntity, o.Header+" reused with a different request", nil))
+			case rec.Response == nil:
+				ctx.Header().Set("Retry-After", "1")
+				ctx.Error(tiny.NewHTTPError(http.StatusConflict, "Request with the same "+o.Header+" in progress", nil))
+			case rec.Response.Status == 0:
+				ctx.Error(tiny.NewHTTPError(http.StatusConflict, "Response to the same "+o.Header+" too large to replay", nil))
+			default:
+				ctx.Header().Set(replayed, "true")
+				ctx.Replay(rec.Response)
+			}
+			return
+		}
+		b := ctx.Buffer(int(o.MaxBytes))
+		ctx.OnFinish(func() {
+			status := ctx.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if ctx.Panicked() || status >= 500 {
+				log.ErrError(o.Store.Abort(key))
+				return
+			}
+			res := b.Response()
+			if b.Spilled() {
+				// completed but not replayable, retries are rejected rather than run again
+				res = new(Response)
+			}
+			if err := o.Store.Complete(key, res); err != nil {
+				log.Errorln(err)
+				log.ErrError(o.Store.Abort(key))
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package idempotency
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cxr29/tiny"
+)
+
+func newServer(o *Options, f func(ctx *tiny.Context)) (http.Handler, *int) {
+	n := new(int)
+	r := new(tiny.Router)
+	r.Use(New(o))
+	r.POST("/orders", func(ctx *tiny.Context) {
+		*n++
+		f(ctx)
+	})
+	return r.Handler(), n
+}
+
+func post(h http.Handler, key, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/orders", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func options() *Options {
+	o := *DefaultOptions
+	o.Store = NewMemoryStore(time.Hour)
+	return &o
+}
+
+func TestReplay(t *testing.T) {
+	h, n := newServer(options(), func(ctx *tiny.Context) {
+		ctx.Header().Set("Location", "/orders/1")
+		ctx.WriteHeader(http.StatusCreated)
+		ctx.WriteString("created")
+	})
+	w := post(h, "k", "a")
+	if w.Code != 201 || w.Header().Get(replayed) != "" {
+		t.Fatalf("first: %d %v", w.Code, w.Header())
+	}
+	w = post(h, "k", "a")
+	if w.Code != 201 || w.Body.String() != "created" || w.Header().Get("Location") != "/orders/1" ||
+		w.Header().Get(replayed) != "true" {
+		t.Errorf("replay: %d %q %v", w.Code, w.Body, w.Header())
+	}
+	if *n != 1 {
+		t.Errorf("ran %d times", *n)
+	}
+
+	// without the key or with other credentials
+	post(h, "", "a")
+	post(h, "k", "a", "Authorization", "Bearer x")
+	if *n != 3 {
+		t.Errorf("ran %d times", *n)
+	}
+	if w = post(h, "k", "a", "Authorization", "Bearer x"); w.Header().Get(replayed) != "true" || *n != 3 {
+		t.Errorf("scoped replay: %v, ran %d times", w.Header(), *n)
+	}
+}
+
+func TestConflict(t *testing.T) {
+	h, n := newServer(options(), func(ctx *tiny.Context) {
+		ctx.WriteString("ok")
+	})
+	post(h, "k", "a")
+	if w := post(h, "k", "b"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("different body: %d", w.Code)
+	}
+	if *n != 1 {
+		t.Errorf("ran %d times", *n)
+	}
+}
+
+func TestInFlight(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	h, _ := newServer(options(), func(ctx *tiny.Context) {
+		close(started)
+		<-release
+		ctx.WriteString("ok")
+	})
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- post(h, "k", "a") }()
+	<-started
+	w := post(h, "k", "a")
+	if w.Code != http.StatusConflict || w.Header().Get("Retry-After") == "" {
+		t.Errorf("in flight: %d %v", w.Code, w.Header())
+	}
+	close(release)
+	if w = <-done; w.Code != 200 {
+		t.Errorf("first: %d", w.Code)
+	}
+}
+
+func TestNotReplayed(t *testing.T) {
+	o := options()
+	o.MaxBytes = 4
+	o.Required = true
+	fail := true
+	h, n := newServer(o, func(ctx *tiny.Context) {
+		if fail {
+			ctx.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		ctx.WriteString("too large")
+	})
+	if w := post(h, "", "a"); w.Code != http.StatusBadRequest {
+		t.Errorf("missing key: %d", w.Code)
+	}
+	if w := post(h, "k", "abcde"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large body: %d", w.Code)
+	}
+
+	// server errors release the key
+	post(h, "k", "a")
+	fail = false
+	if w := post(h, "k", "a"); w.Code != 200 || w.Body.String() != "too large" {
+		t.Errorf("retry: %d %q", w.Code, w.Body)
+	}
+	// spilled responses are completed without a replay
+	if w := post(h, "k", "a"); w.Code != http.StatusConflict || w.Header().Get(replayed) != "" {
+		t.Errorf("spilled: %d %v", w.Code, w.Header())
+	}
+	if *n != 2 {
+		t.Errorf("ran %d times", *n)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package idempotency
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cxr29/tiny"
+)
+
+type Response = tiny.Response
+
+// Response is nil while the first request is in flight,
+// its Status is 0 if the response was too large to replay
+type Record struct {
+	Fingerprint string
+	Response    *Response
+}
+
+type Store interface {
+	// reserve the key if absent, otherwise return the existing record
+	Begin(key, fingerprint string) (rec *Record, reserved bool, err error)
+	Complete(key string, res *Response) error
+	// release the key so a retry runs again
+	Abort(key string) error
+}
+
+type memoryRecord struct {
+	Record
+	expires time.Time
+}
+
+type MemoryStore struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	records map[string]*memoryRecord
+	swept   time.Time
+}
+
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		ttl:     ttl,
+		records: make(map[string]*memoryRecord),
+		swept:   time.Now(),
+	}
+}
+
+func (s *MemoryStore) Begin(key, fingerprint string) (*Record, bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.swept) > time.Minute {
+		for k, r := range s.records {
+			if now.After(r.expires) {
+				delete(s.records, k)
+			}
+		}
+		s.swept = now
+	}
+	if r, ok := s.records[key]; ok && now.Before(r.expires) {
+		rec := r.Record
+		return &rec, false, nil
+	}
+	s.records[key] = &memoryRecord{Record{Fingerprint: fingerprint}, now.Add(s.ttl)}
+	return nil, true, nil
+}
+
+func (s *MemoryStore) Complete(key string, res *Response) error {
+	s.mu.Lock()
+	if r, ok := s.records[key]; ok {
+		r.Response = res
+		r.expires = time.Now().Add(s.ttl)
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) Abort(key string) error {
+	s.mu.Lock()
+	delete(s.records, key)
+	s.mu.Unlock()
+	return nil
+}
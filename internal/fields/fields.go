@@ -0,0 +1,112 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+// struct fields tagged like encoding/json, shared by msgpack and cbor
+package fields
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+type Field struct {
+	Name      string
+	Index     []int
+	Tagged    bool
+	OmitEmpty bool
+}
+
+type cacheKey struct {
+	t   reflect.Type
+	tag string
+}
+
+var cache sync.Map
+
+// the exported fields of t, the tag falls back to json
+func Of(t reflect.Type, tag string) []*Field {
+	k := cacheKey{t, tag}
+	if v, ok := cache.Load(k); ok {
+		return v.([]*Field)
+	}
+	a := dominant(appendFields(nil, t, tag, nil))
+	cache.Store(k, a)
+	return a
+}
+
+// an exact match first, then case insensitive
+func ByName(a []*Field, name string) *Field {
+	for _, f := range a {
+		if f.Name == name {
+			return f
+		}
+	}
+	for _, f := range a {
+		if strings.EqualFold(f.Name, name) {
+			return f
+		}
+	}
+	return nil
+}
+
+func appendFields(a []*Field, t reflect.Type, tagName string, index []int) []*Field {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+		tag, ok := sf.Tag.Lookup(tagName)
+		if !ok {
+			tag = sf.Tag.Get("json")
+		}
+		if tag == "-" {
+			continue
+		}
+		idx := make([]int, len(index)+1)
+		copy(idx, index)
+		idx[len(index)] = i
+		name, opts := tag, ""
+		if j := strings.IndexByte(tag, ','); j >= 0 {
+			name, opts = tag[:j], tag[j:]
+		}
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			a = appendFields(a, sf.Type, tagName, idx)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		f := &Field{Name: name, Index: idx, Tagged: name != ""}
+		if name == "" {
+			f.Name = sf.Name
+		}
+		f.OmitEmpty = strings.Contains(opts+",", ",omitempty,")
+		a = append(a, f)
+	}
+	return a
+}
+
+// the shallowest field wins, then the tagged one, or neither if ambiguous
+func dominant(a []*Field) []*Field {
+	best := make(map[string]*Field, len(a))
+	ambiguous := make(map[string]bool)
+	for _, f := range a {
+		g, ok := best[f.Name]
+		switch {
+		case !ok || len(f.Index) < len(g.Index) || len(f.Index) == len(g.Index) && f.Tagged && !g.Tagged:
+			best[f.Name] = f
+			delete(ambiguous, f.Name)
+		case len(f.Index) == len(g.Index) && f.Tagged == g.Tagged:
+			ambiguous[f.Name] = true
+		}
+	}
+	b := a[:0:0]
+	for _, f := range a {
+		if best[f.Name] == f && !ambiguous[f.Name] {
+			b = append(b, f)
+		}
+	}
+	return b
+}
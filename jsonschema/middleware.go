@@ -0,0 +1,88 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/cxr29/tiny"
+)
+
+var keyBody = tiny.NewValueKey()
+
+func Pull(ctx *tiny.Context) interface{} {
+	return ctx.Value(keyBody)
+}
+
+type report struct {
+	XMLName xml.Name `json:"-" xml:"errors"`
+	Errors  Errors   `json:"errors" xml:"error"`
+}
+
+func isJSON(s string) bool {
+	t, _, err := mime.ParseMediaType(s)
+	return err == nil && (t == "application/json" || strings.HasSuffix(t, "+json"))
+}
+
+func New(s *Schema) tiny.HandlerFunc {
+	if s == nil {
+		panic("nil schema")
+	}
+	return func(ctx *tiny.Context) {
+		r := ctx.Request
+		if !isJSON(r.Header.Get("Content-Type")) {
+			ctx.Error(tiny.NewHTTPError(http.StatusUnsupportedMediaType, "", nil))
+			return
+		}
+		var body io.Reader = r.Body
+		if n := tiny.DefaultDecodeOptions.MaxBodySize; n > 0 {
+			body = http.MaxBytesReader(ctx, r.Body, n)
+		}
+		data, err := io.ReadAll(body)
+		r.Body.Close()
+		if err != nil {
+			var mbe *http.MaxBytesError
+			if errors.As(err, &mbe) {
+				ctx.Error(tiny.NewHTTPError(http.StatusRequestEntityTooLarge, "", nil))
+			} else {
+				ctx.BadRequest()
+			}
+			return
+		}
+		var v interface{}
+		d := json.NewDecoder(bytes.NewReader(data))
+		d.UseNumber()
+		if err := d.Decode(&v); err != nil {
+			ctx.BadRequest()
+			return
+		}
+		if _, err := d.Token(); err != io.EOF {
+			ctx.BadRequest()
+			return
+		}
+		if err := s.Validate(v); err != nil {
+			if a, ok := err.(Errors); ok {
+				ctx.Respond(http.StatusUnprocessableEntity, report{Errors: a})
+			} else {
+				ctx.BadRequest()
+			}
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(data))
+		r.ContentLength = int64(len(data))
+		// the innermost schema wins when nested groups validate too
+		if ctx.Values == nil {
+			ctx.Values = make(map[interface{}]interface{}, 10)
+		}
+		ctx.Values[keyBody] = v
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package jsonschema
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cxr29/tiny"
+)
+
+func TestMiddleware(t *testing.T) {
+	s := MustCompile([]byte(`{
+		"type": "object",
+		"required": ["name"],
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"tags": {"type": "array", "items": {"type": "string"}}
+		},
+		"additionalProperties": false
+	}`))
+	r := new(tiny.Router)
+	r.POST("/", New(s), func(ctx *tiny.Context) {
+		data, _ := io.ReadAll(ctx.Request.Body)
+		v, _ := json.Marshal(Pull(ctx))
+		ctx.WriteString(string(data) + " " + string(v))
+	})
+	h := r.Handler()
+	for _, c := range []struct {
+		contentType, body string
+		status            int
+		want              []location
+	}{
+		{"application/json", `{"name":"a","tags":["b"]}`, http.StatusOK, nil},
+		{"application/merge-patch+json; charset=utf-8", `{"name":"a"}`, http.StatusOK, nil},
+		{"text/plain", `{"name":"a"}`, http.StatusUnsupportedMediaType, nil},
+		{"application/json", `{"name":`, http.StatusBadRequest, nil},
+		{"application/json", `{"name":"a"} {}`, http.StatusBadRequest, nil},
+		{"application/json", `{"name":"","tags":["b",1],"x":true}`, http.StatusUnprocessableEntity, []location{
+			{"/name", "/properties/name/minLength"},
+			{"/tags/1", "/properties/tags/items/type"},
+			{"/x", "/additionalProperties"},
+		}},
+		{"application/json", `[]`, http.StatusUnprocessableEntity, []location{{"", "/type"}}},
+	} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(c.body))
+		req.Header.Set("Content-Type", c.contentType)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != c.status {
+			t.Errorf("%s %s: status %d, want %d", c.contentType, c.body, w.Code, c.status)
+			continue
+		}
+		switch c.status {
+		case http.StatusOK:
+			if want := c.body + " " + c.body; w.Body.String() != want {
+				t.Errorf("%s: got %s, want %s", c.body, w.Body, want)
+			}
+		case http.StatusUnprocessableEntity:
+			var res struct {
+				Errors []struct {
+					InstanceLocation string `json:"instanceLocation"`
+					KeywordLocation  string `json:"keywordLocation"`
+					Error            string `json:"error"`
+				} `json:"errors"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Errorf("%s: %v %s", c.body, err, w.Body)
+				continue
+			}
+			got := make([]location, len(res.Errors))
+			for i, e := range res.Errors {
+				got[i] = location{e.InstanceLocation, e.KeywordLocation}
+				if e.Error == "" {
+					t.Errorf("%s: no message at %s", c.body, e.InstanceLocation)
+				}
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("%s: got %v, want %v", c.body, got, c.want)
+			}
+		}
+	}
+}
+
+func TestMiddlewareNested(t *testing.T) {
+	r := new(tiny.Router)
+	r.Group("/v1", func(r *tiny.Router) {
+		r.POST("/", New(MustCompile([]byte(`{"required":["b"]}`))), func(ctx *tiny.Context) {
+			v, _ := json.Marshal(Pull(ctx))
+			ctx.WriteString(string(v))
+		})
+	}, New(MustCompile([]byte(`{"required":["a"]}`))))
+	h := r.Handler()
+	for _, c := range []struct {
+		body   string
+		status int
+	}{
+		{`{"a":1,"b":2}`, http.StatusOK},
+		{`{"a":1}`, http.StatusUnprocessableEntity},
+		{`{"b":2}`, http.StatusUnprocessableEntity},
+	} {
+		req := httptest.NewRequest("POST", "/v1/", strings.NewReader(c.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != c.status {
+			t.Errorf("%s: status %d, want %d", c.body, w.Code, c.status)
+		} else if c.status == http.StatusOK && w.Body.String() != c.body {
+			t.Errorf("%s: got %s", c.body, w.Body)
+		}
+	}
+}
@@ -0,0 +1,610 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type Schema struct {
+	root  *schema
+	cache map[string]*schema
+}
+
+type schema struct {
+	boolean *bool
+
+	ref string
+
+	types    []string
+	enum     []interface{}
+	konst    interface{}
+	hasConst bool
+
+	multipleOf                                           *float64
+	minimum, maximum, exclusiveMinimum, exclusiveMaximum *float64
+
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+	format               string
+
+	items              *schema
+	prefixItems        []*schema
+	minItems, maxItems *int
+	uniqueItems        bool
+
+	properties           map[string]*schema
+	patternProperties    []patternProperty
+	additionalProperties *schema
+	required             []string
+	minProperties        *int
+	maxProperties        *int
+
+	allOf, anyOf, oneOf []*schema
+	not                 *schema
+}
+
+type patternProperty struct {
+	pattern *regexp.Regexp
+	schema  *schema
+}
+
+func Compile(data []byte) (*Schema, error) {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	s := &Schema{cache: make(map[string]*schema, 10)}
+	root, err := s.compile(v, "#")
+	if err != nil {
+		return nil, err
+	}
+	s.root = root
+	if err := s.resolve(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func MustCompile(data []byte) *Schema {
+	s, err := Compile(data)
+	if err != nil {
+		panic("jsonschema: " + err.Error())
+	}
+	return s
+}
+
+func (s *Schema) compile(v interface{}, loc string) (*schema, error) {
+	switch v := v.(type) {
+	case bool:
+		x := &schema{boolean: &v}
+		s.cache[loc] = x
+		return x, nil
+	case map[string]interface{}:
+		return s.compileObject(v, loc)
+	}
+	return nil, fmt.Errorf("%s: schema must be an object or boolean", loc)
+}
+
+func (s *Schema) compileObject(m map[string]interface{}, loc string) (x *schema, err error) {
+	x = new(schema)
+	s.cache[loc] = x
+	sub := func(k string) (*schema, error) {
+		if v, ok := m[k]; ok {
+			return s.compile(v, loc+"/"+escape(k))
+		}
+		return nil, nil
+	}
+	subs := func(k string) (a []*schema, err error) {
+		if v, ok := m[k]; ok {
+			l, ok := v.([]interface{})
+			if !ok || len(l) == 0 {
+				return nil, fmt.Errorf("%s/%s: must be a non-empty array", loc, k)
+			}
+			a = make([]*schema, len(l))
+			for i, v := range l {
+				if a[i], err = s.compile(v, loc+"/"+k+"/"+strconv.Itoa(i)); err != nil {
+					return
+				}
+			}
+		}
+		return
+	}
+	num := func(k string) (*float64, error) {
+		if v, ok := m[k]; ok {
+			n, ok := v.(json.Number)
+			if !ok {
+				return nil, fmt.Errorf("%s/%s: must be a number", loc, k)
+			}
+			f, err := n.Float64()
+			return &f, err
+		}
+		return nil, nil
+	}
+	count := func(k string) (*int, error) {
+		f, err := num(k)
+		if f == nil || err != nil {
+			return nil, err
+		}
+		if *f < 0 || *f != math.Trunc(*f) {
+			return nil, fmt.Errorf("%s/%s: must be a non-negative integer", loc, k)
+		}
+		i := int(*f)
+		return &i, nil
+	}
+	if v, ok := m["$ref"]; ok {
+		if x.ref, ok = v.(string); !ok {
+			return nil, fmt.Errorf("%s/$ref: must be a string", loc)
+		}
+	}
+	for _, k := range [...]string{"$defs", "definitions"} {
+		if v, ok := m[k]; ok {
+			d, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s/%s: must be an object", loc, k)
+			}
+			for name, v := range d {
+				if _, err = s.compile(v, loc+"/"+k+"/"+escape(name)); err != nil {
+					return
+				}
+			}
+		}
+	}
+	if v, ok := m["type"]; ok {
+		switch v := v.(type) {
+		case string:
+			x.types = []string{v}
+		case []interface{}:
+			for _, i := range v {
+				t, ok := i.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s/type: must be a string or array of strings", loc)
+				}
+				x.types = append(x.types, t)
+			}
+		default:
+			return nil, fmt.Errorf("%s/type: must be a string or array of strings", loc)
+		}
+		for _, t := range x.types {
+			switch t {
+			case "null", "boolean", "object", "array", "number", "string", "integer":
+			default:
+				return nil, fmt.Errorf("%s/type: unknown type %q", loc, t)
+			}
+		}
+	}
+	if v, ok := m["enum"]; ok {
+		if x.enum, ok = v.([]interface{}); !ok {
+			return nil, fmt.Errorf("%s/enum: must be an array", loc)
+		}
+		x.enum = normalize(x.enum).([]interface{})
+	}
+	x.konst, x.hasConst = m["const"]
+	x.konst = normalize(x.konst)
+	if x.multipleOf, err = num("multipleOf"); err != nil {
+		return
+	}
+	if x.minimum, err = num("minimum"); err != nil {
+		return
+	}
+	if x.maximum, err = num("maximum"); err != nil {
+		return
+	}
+	if x.exclusiveMinimum, err = num("exclusiveMinimum"); err != nil {
+		return
+	}
+	if x.exclusiveMaximum, err = num("exclusiveMaximum"); err != nil {
+		return
+	}
+	if x.minLength, err = count("minLength"); err != nil {
+		return
+	}
+	if x.maxLength, err = count("maxLength"); err != nil {
+		return
+	}
+	if v, ok := m["pattern"]; ok {
+		p, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s/pattern: must be a string", loc)
+		}
+		if x.pattern, err = regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("%s/pattern: %v", loc, err)
+		}
+	}
+	if v, ok := m["format"]; ok {
+		x.format, _ = v.(string)
+	}
+	if x.items, err = sub("items"); err != nil {
+		return
+	}
+	if x.prefixItems, err = subs("prefixItems"); err != nil {
+		return
+	}
+	if x.minItems, err = count("minItems"); err != nil {
+		return
+	}
+	if x.maxItems, err = count("maxItems"); err != nil {
+		return
+	}
+	if v, ok := m["uniqueItems"]; ok {
+		x.uniqueItems, _ = v.(bool)
+	}
+	if v, ok := m["properties"]; ok {
+		p, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s/properties: must be an object", loc)
+		}
+		x.properties = make(map[string]*schema, len(p))
+		for k, v := range p {
+			if x.properties[k], err = s.compile(v, loc+"/properties/"+escape(k)); err != nil {
+				return
+			}
+		}
+	}
+	if v, ok := m["patternProperties"]; ok {
+		p, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s/patternProperties: must be an object", loc)
+		}
+		keys := make([]string, 0, len(p))
+		for k := range p {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			r, err := regexp.Compile(k)
+			if err != nil {
+				return nil, fmt.Errorf("%s/patternProperties: %v", loc, err)
+			}
+			y, err := s.compile(p[k], loc+"/patternProperties/"+escape(k))
+			if err != nil {
+				return nil, err
+			}
+			x.patternProperties = append(x.patternProperties, patternProperty{r, y})
+		}
+	}
+	if x.additionalProperties, err = sub("additionalProperties"); err != nil {
+		return
+	}
+	if v, ok := m["required"]; ok {
+		a, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s/required: must be an array", loc)
+		}
+		for _, i := range a {
+			k, ok := i.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s/required: must be an array of strings", loc)
+			}
+			x.required = append(x.required, k)
+		}
+	}
+	if x.minProperties, err = count("minProperties"); err != nil {
+		return
+	}
+	if x.maxProperties, err = count("maxProperties"); err != nil {
+		return
+	}
+	if x.allOf, err = subs("allOf"); err != nil {
+		return
+	}
+	if x.anyOf, err = subs("anyOf"); err != nil {
+		return
+	}
+	if x.oneOf, err = subs("oneOf"); err != nil {
+		return
+	}
+	if x.not, err = sub("not"); err != nil {
+		return
+	}
+	return
+}
+
+// check every $ref points into the document
+func (s *Schema) resolve() error {
+	for loc, x := range s.cache {
+		if x.ref == "" {
+			continue
+		}
+		if _, err := s.lookup(x.ref); err != nil {
+			return fmt.Errorf("%s/$ref: %v", loc, err)
+		}
+	}
+	return nil
+}
+
+func (s *Schema) lookup(ref string) (*schema, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, errors.New("only references within the document are supported: " + ref)
+	}
+	ref, err := url.PathUnescape(ref)
+	if err != nil {
+		return nil, err
+	}
+	if x, ok := s.cache[ref]; ok {
+		return x, nil
+	}
+	return nil, errors.New("unresolvable reference: " + ref)
+}
+
+func escape(s string) string {
+	s = strings.Replace(s, "~", "~0", -1)
+	return strings.Replace(s, "/", "~1", -1)
+}
+
+type Error struct {
+	InstanceLocation string `json:"instanceLocation" xml:"instanceLocation"`
+	KeywordLocation  string `json:"keywordLocation" xml:"keywordLocation"`
+	Message          string `json:"error" xml:"error"`
+}
+
+func (e *Error) Error() string {
+	if e.InstanceLocation == "" {
+		return e.Message
+	}
+	return e.InstanceLocation + ": " + e.Message
+}
+
+type Errors []*Error
+
+func (a Errors) Error() string {
+	s := make([]string, len(a))
+	for i, e := range a {
+		s[i] = e.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+func (a Errors) Unwrap() []error {
+	errs := make([]error, len(a))
+	for i, e := range a {
+		errs[i] = e
+	}
+	return errs
+}
+
+func (a Errors) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+func (s *Schema) Validate(v interface{}) error {
+	switch v.(type) {
+	case nil, bool, string, float64, json.Number, []interface{}, map[string]interface{}:
+	default:
+		p, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return s.ValidateJSON(p)
+	}
+	var a Errors
+	steps := 0
+	s.validate(s.root, normalize(v), "", "", &a, &steps, 0)
+	if steps > maxSteps {
+		return Errors{{Message: "maximum validation steps exceeded"}}
+	}
+	if len(a) > 0 {
+		return a
+	}
+	return nil
+}
+
+func (s *Schema) ValidateJSON(data []byte) error {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return err
+	}
+	return s.Validate(v)
+}
+
+const maxDepth = 256
+
+// bounds schemas that expand exponentially through $ref
+const maxSteps = 1 << 16
+
+// v is normalized
+func (s *Schema) validate(x *schema, v interface{}, inst, kw string, a *Errors, steps *int, depth int) {
+	if *steps++; *steps > maxSteps {
+		return
+	}
+	fail := func(k, format string, args ...interface{}) {
+		*a = append(*a, &Error{inst, kw + "/" + k, fmt.Sprintf(format, args...)})
+	}
+	if depth > maxDepth {
+		fail("$ref", "maximum reference depth exceeded")
+		return
+	}
+	if x.boolean != nil {
+		if !*x.boolean {
+			*a = append(*a, &Error{inst, kw, "not allowed"})
+		}
+		return
+	}
+	if x.ref != "" {
+		r, err := s.lookup(x.ref)
+		if err != nil {
+			fail("$ref", "%v", err)
+		} else {
+			s.validate(r, v, inst, kw+"/$ref", a, steps, depth+1)
+		}
+	}
+	if len(x.types) > 0 {
+		t := typeOf(v)
+		ok := false
+		for _, i := range x.types {
+			if i == t || (i == "number" && t == "integer") {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			fail("type", "expected %s, got %s", strings.Join(x.types, " or "), t)
+			return
+		}
+	}
+	if x.enum != nil {
+		ok := false
+		for _, e := range x.enum {
+			if equal(v, e) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			fail("enum", "value must be one of the enumerated values")
+		}
+	}
+	if x.hasConst && !equal(v, x.konst) {
+		fail("const", "value must be %v", x.konst)
+	}
+	switch v := v.(type) {
+	case float64:
+		s.validateNumber(x, v, fail)
+	case string:
+		n := utf8.RuneCountInString(v)
+		if x.minLength != nil && n < *x.minLength {
+			fail("minLength", "length must be >= %d", *x.minLength)
+		}
+		if x.maxLength != nil && n > *x.maxLength {
+			fail("maxLength", "length must be <= %d", *x.maxLength)
+		}
+		if x.pattern != nil && !x.pattern.MatchString(v) {
+			fail("pattern", "does not match pattern %q", x.pattern.String())
+		}
+		if x.format != "" && !checkFormat(x.format, v) {
+			fail("format", "is not a valid %s", x.format)
+		}
+	case []interface{}:
+		if x.minItems != nil && len(v) < *x.minItems {
+			fail("minItems", "must have at least %d items", *x.minItems)
+		}
+		if x.maxItems != nil && len(v) > *x.maxItems {
+			fail("maxItems", "must have at most %d items", *x.maxItems)
+		}
+		if x.uniqueItems {
+		Unique:
+			for i := 1; i < len(v); i++ {
+				for j := 0; j < i; j++ {
+					if equal(v[i], v[j]) {
+						fail("uniqueItems", "items at %d and %d are equal", j, i)
+						break Unique
+					}
+				}
+			}
+		}
+		for i, item := range v {
+			p := inst + "/" + strconv.Itoa(i)
+			if i < len(x.prefixItems) {
+				s.validate(x.prefixItems[i], item, p, kw+"/prefixItems/"+strconv.Itoa(i), a, steps, depth)
+			} else if x.items != nil {
+				s.validate(x.items, item, p, kw+"/items", a, steps, depth)
+			}
+		}
+	case map[string]interface{}:
+		if x.minProperties != nil && len(v) < *x.minProperties {
+			fail("minProperties", "must have at least %d properties", *x.minProperties)
+		}
+		if x.maxProperties != nil && len(v) > *x.maxProperties {
+			fail("maxProperties", "must have at most %d properties", *x.maxProperties)
+		}
+		for _, k := range x.required {
+			if _, ok := v[k]; !ok {
+				fail("required", "missing property %q", k)
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := inst + "/" + escape(k)
+			matched := false
+			if y, ok := x.properties[k]; ok {
+				matched = true
+				s.validate(y, v[k], p, kw+"/properties/"+escape(k), a, steps, depth)
+			}
+			for _, pp := range x.patternProperties {
+				if pp.pattern.MatchString(k) {
+					matched = true
+					s.validate(pp.schema, v[k], p, kw+"/patternProperties/"+escape(pp.pattern.String()), a, steps, depth)
+				}
+			}
+			if !matched && x.additionalProperties != nil {
+				s.validate(x.additionalProperties, v[k], p, kw+"/additionalProperties", a, steps, depth)
+			}
+		}
+	}
+	for i, y := range x.allOf {
+		s.validate(y, v, inst, kw+"/allOf/"+strconv.Itoa(i), a, steps, depth)
+	}
+	if len(x.anyOf) > 0 {
+		ok := false
+		for _, y := range x.anyOf {
+			if s.valid(y, v, steps, depth) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			fail("anyOf", "must match at least one schema")
+		}
+	}
+	if len(x.oneOf) > 0 {
+		n := 0
+		for _, y := range x.oneOf {
+			if s.valid(y, v, steps, depth) {
+				n++
+			}
+		}
+		if n != 1 {
+			fail("oneOf", "must match exactly one schema, matched %d", n)
+		}
+	}
+	if x.not != nil && s.valid(x.not, v, steps, depth) {
+		fail("not", "must not match the schema")
+	}
+}
+
+func (s *Schema) valid(x *schema, v interface{}, steps *int, depth int) bool {
+	var a Errors
+	s.validate(x, v, "", "", &a, steps, depth)
+	return len(a) == 0
+}
+
+func (s *Schema) validateNumber(x *schema, f float64, fail func(string, string, ...interface{})) {
+	if x.multipleOf != nil && *x.multipleOf > 0 {
+		if q := f / *x.multipleOf; math.Abs(q-math.Round(q)) > 1e-9 {
+			fail("multipleOf", "must be a multiple of %v", *x.multipleOf)
+		}
+	}
+	if x.minimum != nil && f < *x.minimum {
+		fail("minimum", "must be >= %v", *x.minimum)
+	}
+	if x.maximum != nil && f > *x.maximum {
+		fail("maximum", "must be <= %v", *x.maximum)
+	}
+	if x.exclusiveMinimum != nil && f <= *x.exclusiveMinimum {
+		fail("exclusiveMinimum", "must be > %v", *x.exclusiveMinimum)
+	}
+	if x.exclusiveMaximum != nil && f >= *x.exclusiveMaximum {
+		fail("exclusiveMaximum", "must be < %v", *x.exclusiveMaximum)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package jsonschema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type location struct {
+	inst, kw string
+}
+
+func locations(err error) []location {
+	a, _ := err.(Errors)
+	l := make([]location, len(a))
+	for i, e := range a {
+		l[i] = location{e.InstanceLocation, e.KeywordLocation}
+	}
+	return l
+}
+
+func TestKeywords(t *testing.T) {
+	for _, c := range []struct {
+		schema, instance string
+		want             []location // nil if valid
+	}{
+		{`true`, `{"a":1}`, nil},
+		{`false`, `null`, []location{{"", ""}}},
+		{`{}`, `[1,"a",null]`, nil},
+
+		{`{"type":"string"}`, `"a"`, nil},
+		{`{"type":"string"}`, `1`, []location{{"", "/type"}}},
+		{`{"type":"integer"}`, `1.0`, nil},
+		{`{"type":"integer"}`, `1.5`, []location{{"", "/type"}}},
+		{`{"type":"number"}`, `1`, nil},
+		{`{"type":["string","null"]}`, `null`, nil},
+		{`{"type":["string","null"]}`, `false`, []location{{"", "/type"}}},
+		{`{"type":"object"}`, `[]`, []location{{"", "/type"}}},
+
+		{`{"enum":[1,"a",{"b":[2]}]}`, `{"b":[2]}`, nil},
+		{`{"enum":[1,"a"]}`, `1.0`, nil},
+		{`{"enum":[1,"a"]}`, `"b"`, []location{{"", "/enum"}}},
+		{`{"const":{"a":1}}`, `{"a":1}`, nil},
+		{`{"const":{"a":1}}`, `{"a":2}`, []location{{"", "/const"}}},
+
+		{`{"multipleOf":0.1}`, `0.3`, nil},
+		{`{"multipleOf":0.1}`, `0.35`, []location{{"", "/multipleOf"}}},
+		{`{"minimum":2}`, `2`, nil},
+		{`{"minimum":2}`, `1`, []location{{"", "/minimum"}}},
+		{`{"maximum":2}`, `3`, []location{{"", "/maximum"}}},
+		{`{"exclusiveMinimum":2}`, `2`, []location{{"", "/exclusiveMinimum"}}},
+		{`{"exclusiveMaximum":2}`, `2`, []location{{"", "/exclusiveMaximum"}}},
+		{`{"minimum":2}`, `"1"`, nil},
+
+		{`{"minLength":2}`, `"éé"`, nil},
+		{`{"minLength":2}`, `"é"`, []location{{"", "/minLength"}}},
+		{`{"maxLength":1}`, `"ab"`, []location{{"", "/maxLength"}}},
+		{`{"pattern":"^a"}`, `"ab"`, nil},
+		{`{"pattern":"^a"}`, `"ba"`, []location{{"", "/pattern"}}},
+		{`{"format":"date-time"}`, `"2016-01-02T15:04:05Z"`, nil},
+		{`{"format":"date-time"}`, `"2016-01-02"`, []location{{"", "/format"}}},
+		{`{"format":"email"}`, `"a@b.c"`, nil},
+		{`{"format":"email"}`, `"A <a@b.c>"`, []location{{"", "/format"}}},
+		{`{"format":"ipv4"}`, `"::ffff:1.2.3.4"`, []location{{"", "/format"}}},
+		{`{"format":"ipv6"}`, `"::1"`, nil},
+		{`{"format":"uuid"}`, `"123e4567-e89b-12d3-a456-426614174000"`, nil},
+		{`{"format":"unknown"}`, `"anything"`, nil},
+
+		{`{"items":{"type":"integer"}}`, `[1,"a",2,null]`, []location{{"/1", "/items/type"}, {"/3", "/items/type"}}},
+		{`{"prefixItems":[{"type":"string"}],"items":false}`, `["a"]`, nil},
+		{`{"prefixItems":[{"type":"string"}],"items":false}`, `[1,2]`, []location{{"/0", "/prefixItems/0/type"}, {"/1", "/items"}}},
+		{`{"minItems":2}`, `[1]`, []location{{"", "/minItems"}}},
+		{`{"maxItems":1}`, `[1,2]`, []location{{"", "/maxItems"}}},
+		{`{"uniqueItems":true}`, `[1,{"a":1},{"a":2}]`, nil},
+		{`{"uniqueItems":true}`, `[1,2,1.0]`, []location{{"", "/uniqueItems"}}},
+
+		{`{"properties":{"a":{"type":"string"},"b/c~":{"type":"string"}}}`, `{"a":1,"b/c~":2,"d":3}`,
+			[]location{{"/a", "/properties/a/type"}, {"/b~1c~0", "/properties/b~1c~0/type"}}},
+		{`{"patternProperties":{"^x-":{"type":"string"}}}`, `{"x-a":1,"y":1}`, []location{{"/x-a", "/patternProperties/^x-/type"}}},
+		{`{"properties":{"a":{}},"patternProperties":{"^x-":{}},"additionalProperties":false}`, `{"a":1,"x-b":2,"c":3}`,
+			[]location{{"/c", "/additionalProperties"}}},
+		{`{"additionalProperties":{"type":"integer"}}`, `{"a":1,"b":"2"}`, []location{{"/b", "/additionalProperties/type"}}},
+		{`{"required":["a","b"]}`, `{"a":null}`, []location{{"", "/required"}}},
+		{`{"required":["a"]}`, `[]`, nil},
+		{`{"minProperties":1}`, `{}`, []location{{"", "/minProperties"}}},
+		{`{"maxProperties":1}`, `{"a":1,"b":2}`, []location{{"", "/maxProperties"}}},
+
+		{`{"allOf":[{"type":"number"},{"minimum":2}]}`, `1`, []location{{"", "/allOf/1/minimum"}}},
+		{`{"anyOf":[{"type":"string"},{"minimum":2}]}`, `2`, nil},
+		{`{"anyOf":[{"type":"string"},{"minimum":2}]}`, `1`, []location{{"", "/anyOf"}}},
+		{`{"oneOf":[{"type":"number"},{"minimum":2}]}`, `1`, nil},
+		{`{"oneOf":[{"type":"number"},{"minimum":2}]}`, `3`, []location{{"", "/oneOf"}}},
+		{`{"oneOf":[{"type":"string"},{"type":"null"}]}`, `1`, []location{{"", "/oneOf"}}},
+		{`{"not":{"type":"null"}}`, `null`, []location{{"", "/not"}}},
+
+		{`{"$defs":{"pos":{"minimum":1}},"properties":{"a":{"$ref":"#/$defs/pos"}}}`, `{"a":0}`,
+			[]location{{"/a", "/properties/a/$ref/minimum"}}},
+		{`{"definitions":{"a b":{"type":"string"}},"items":{"$ref":"#/definitions/a%20b"}}`, `["x",1]`,
+			[]location{{"/1", "/items/$ref/type"}}},
+		{`{"properties":{"a":{"type":"integer"}},"items":{"$ref":"#/properties/a"}}`, `[1,"x"]`,
+			[]location{{"/1", "/items/$ref/type"}}},
+	} {
+		s, err := Compile([]byte(c.schema))
+		if err != nil {
+			t.Errorf("%s: %v", c.schema, err)
+			continue
+		}
+		err = s.ValidateJSON([]byte(c.instance))
+		if err != nil && c.want == nil {
+			t.Errorf("%s %s: %v", c.schema, c.instance, err)
+		} else if got := locations(err); c.want != nil && !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s %s: got %v, want %v", c.schema, c.instance, got, c.want)
+		}
+	}
+}
+
+func TestRefCycles(t *testing.T) {
+	list := MustCompile([]byte(`{
+		"$defs": {"node": {"type": "object", "properties": {"next": {"$ref": "#/$defs/node"}}}},
+		"$ref": "#/$defs/node"
+	}`))
+	if err := list.ValidateJSON([]byte(`{"next":{"next":{"next":{}}}}`)); err != nil {
+		t.Error(err)
+	}
+	err := list.ValidateJSON([]byte(`{"next":{"next":5}}`))
+	want := []location{{"/next/next", "/$ref/properties/next/$ref/properties/next/$ref/type"}}
+	if got := locations(err); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, schema := range []string{
+		`{"$ref":"#"}`,
+		`{"$defs":{"a":{"$ref":"#/$defs/b"},"b":{"$ref":"#/$defs/a"}},"$ref":"#/$defs/a"}`,
+		`{"$defs":{"a":{"allOf":[{"$ref":"#/$defs/a"}]}},"properties":{"x":{"$ref":"#/$defs/a"}}}`,
+	} {
+		err := MustCompile([]byte(schema)).ValidateJSON([]byte(`{"x":1}`))
+		if err == nil || !strings.Contains(err.Error(), "maximum reference depth exceeded") {
+			t.Errorf("%s: got %v, want depth exceeded", schema, err)
+		}
+	}
+}
+
+func TestSteps(t *testing.T) {
+	s := MustCompile([]byte(`{"anyOf":[{"$ref":"#"},{"$ref":"#"}]}`))
+	err := s.ValidateJSON([]byte(`{}`))
+	if err == nil || !strings.Contains(err.Error(), "maximum validation steps exceeded") {
+		t.Errorf("got %v, want steps exceeded", err)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, schema := range []string{
+		``,
+		`1`,
+		`{"$ref":"#/$defs/missing"}`,
+		`{"$ref":"other.json#/a"}`,
+		`{"allOf":[]}`,
+		`{"anyOf":{}}`,
+		`{"pattern":"("}`,
+		`{"properties":{"a":1}}`,
+		`{"items":"string"}`,
+	} {
+		if _, err := Compile([]byte(schema)); err == nil {
+			t.Errorf("%s: want error", schema)
+		}
+	}
+}
+
+func TestValidateValue(t *testing.T) {
+	s := MustCompile([]byte(`{"required":["name"],"properties":{"age":{"minimum":0}}}`))
+	type person struct {
+		Name string `json:"name,omitempty"`
+		Age  int    `json:"age"`
+	}
+	if err := s.Validate(person{Name: "a"}); err != nil {
+		t.Error(err)
+	}
+	err := s.Validate(&person{Age: -1})
+	want := []location{{"", "/required"}, {"/age", "/properties/age/minimum"}}
+	if got := locations(err); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if err := s.Validate(map[string]interface{}{"name": "a", "age": 1}); err != nil {
+		t.Error(err)
+	}
+}
@@ -47,7 +47,7 @@ func redirect(ctx *Context, p string, permanent bool) {
 		} else {
 			u := *ctx.Request.URL
 			u.Path = p
-			http.Redirect(ctx, ctx.Request, u.String(), redirectStatusCode(ctx.Request.Method, permanent))
+			ctx.Redirect(u.String(), redirectStatusCode(ctx.Request.Method, permanent))
 		}
 	}
 }
@@ -0,0 +1,543 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package msgpack
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cxr29/tiny/internal/fields"
+)
+
+type SyntaxError struct {
+	msg    string
+	Offset int64
+}
+
+func (e *SyntaxError) Error() string {
+	return "msgpack: " + e.msg + " at offset " + strconv.FormatInt(e.Offset, 10)
+}
+
+type UnmarshalTypeError struct {
+	Value  string
+	Type   reflect.Type
+	Offset int64
+	Field  string
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	if e.Field != "" {
+		return "msgpack: cannot unmarshal " + e.Value + " into field " + e.Field + " of type " + e.Type.String()
+	}
+	return "msgpack: cannot unmarshal " + e.Value + " into value of type " + e.Type.String()
+}
+
+// maps decode into map[string]interface{} if all keys are strings,
+// integers into int64 or uint64 if too large
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("msgpack: Unmarshal(non-pointer %T)", v)
+	}
+	d := &decoder{data: data}
+	if err := d.value(rv.Elem()); err != nil {
+		return err
+	}
+	if d.off < len(d.data) {
+		return d.syntax("trailing data")
+	}
+	return nil
+}
+
+const (
+	kNil = iota
+	kBool
+	kInt
+	kUint
+	kFloat
+	kStr
+	kBin
+	kArray
+	kMap
+	kExt
+)
+
+var kindNames = [...]string{"nil", "bool", "integer", "integer", "float", "string", "binary", "array", "map", "extension"}
+
+type token struct {
+	kind int
+	b    bool
+	i    int64
+	u    uint64
+	f    float64
+	n    int // length of str, bin, ext, array or map
+	ext  int8
+	off  int
+}
+
+type decoder struct {
+	data   []byte
+	off    int
+	depth  int
+	fields []string
+}
+
+func (d *decoder) syntax(msg string) error {
+	return &SyntaxError{msg, int64(d.off)}
+}
+
+func (d *decoder) typeError(t token, typ reflect.Type) error {
+	return &UnmarshalTypeError{kindNames[t.kind], typ, int64(t.off), strings.Join(d.fields, ".")}
+}
+
+func (d *decoder) read(n int) ([]byte, error) {
+	if n > len(d.data)-d.off {
+		return nil, d.syntax("unexpected end of data")
+	}
+	p := d.data[d.off : d.off+n]
+	d.off += n
+	return p, nil
+}
+
+func (d *decoder) uint(n int) (uint64, error) {
+	p, err := d.read(n)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 1:
+		return uint64(p[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(p)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(p)), nil
+	}
+	return binary.BigEndian.Uint64(p), nil
+}
+
+func (d *decoder) head() (t token, err error) {
+	t.off = d.off
+	p, err := d.read(1)
+	if err != nil {
+		return
+	}
+	c := p[0]
+	var u uint64
+	switch {
+	case c <= 0x7f:
+		t.kind, t.i = kInt, int64(c)
+	case c >= 0xe0:
+		t.kind, t.i = kInt, int64(int8(c))
+	case c <= 0x8f:
+		t.kind, t.n = kMap, int(c&0x0f)
+	case c <= 0x9f:
+		t.kind, t.n = kArray, int(c&0x0f)
+	case c <= 0xbf:
+		t.kind, t.n = kStr, int(c&0x1f)
+	case c == 0xc0:
+		t.kind = kNil
+	case c == 0xc2 || c == 0xc3:
+		t.kind, t.b = kBool, c == 0xc3
+	case c >= 0xc4 && c <= 0xc6:
+		t.kind = kBin
+		u, err = d.uint(1 << (c - 0xc4))
+	case c >= 0xc7 && c <= 0xc9:
+		t.kind = kExt
+		u, err = d.uint(1 << (c - 0xc7))
+	case c == 0xca:
+		t.kind = kFloat
+		u, err = d.uint(4)
+		t.f = float64(math.Float32frombits(uint32(u)))
+		u = 0
+	case c == 0xcb:
+		t.kind = kFloat
+		u, err = d.uint(8)
+		t.f = math.Float64frombits(u)
+		u = 0
+	case c >= 0xcc && c <= 0xcf:
+		t.kind = kUint
+		t.u, err = d.uint(1 << (c - 0xcc))
+	case c >= 0xd0 && c <= 0xd3:
+		t.kind = kInt
+		n := 1 << (c - 0xd0)
+		u, err = d.uint(n)
+		t.i = int64(u<<(64-8*n)) >> (64 - 8*n)
+		u = 0
+	case c >= 0xd4 && c <= 0xd8:
+		t.kind, t.n = kExt, 1<<(c-0xd4)
+	case c >= 0xd9 && c <= 0xdb:
+		t.kind = kStr
+		u, err = d.uint(1 << (c - 0xd9))
+	case c == 0xdc || c == 0xdd:
+		t.kind = kArray
+		u, err = d.uint(2 << (c - 0xdc))
+	case c == 0xde || c == 0xdf:
+		t.kind = kMap
+		u, err = d.uint(2 << (c - 0xde))
+	default:
+		err = d.syntax("invalid byte 0x" + strconv.FormatUint(uint64(c), 16))
+	}
+	if err != nil {
+		return
+	}
+	if u > 0 {
+		if u > uint64(len(d.data)-d.off) {
+			err = d.syntax("length exceeds data")
+			return
+		}
+		t.n = int(u)
+	}
+	switch t.kind {
+	case kExt:
+		if p, err = d.read(1); err != nil {
+			return
+		}
+		t.ext = int8(p[0])
+	case kMap:
+		if t.n > (len(d.data)-d.off)/2 {
+			err = d.syntax("length exceeds data")
+		}
+	}
+	return
+}
+
+func (d *decoder) nested(f func() error) error {
+	if d.depth++; d.depth > maxDepth {
+		return errDepth
+	}
+	err := f()
+	d.depth--
+	return err
+}
+
+func (d *decoder) skip() error {
+	_, err := d.any()
+	return err
+}
+
+func (d *decoder) value(v reflect.Value) error {
+	if d.off < len(d.data) && d.data[d.off] == 0xc0 {
+		d.off++
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+	if v.CanAddr() && reflect.PtrTo(v.Type()).Implements(unmarshalerType) {
+		start := d.off
+		if err := d.skip(); err != nil {
+			return err
+		}
+		return v.Addr().Interface().(Unmarshaler).UnmarshalMsgPack(d.data[start:d.off])
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.value(v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() == 0 {
+			x, err := d.any()
+			if err == nil {
+				v.Set(reflect.ValueOf(&x).Elem())
+			}
+			return err
+		}
+	}
+	t, err := d.head()
+	if err != nil {
+		return err
+	}
+	switch t.kind {
+	case kBool:
+		if v.Kind() != reflect.Bool {
+			return d.typeError(t, v.Type())
+		}
+		v.SetBool(t.b)
+	case kInt, kUint, kFloat:
+		return d.number(t, v)
+	case kStr, kBin:
+		p, err := d.read(t.n)
+		if err != nil {
+			return err
+		}
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(p))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(append([]byte(nil), p...))
+		default:
+			return d.typeError(t, v.Type())
+		}
+	case kArray:
+		return d.nested(func() error {
+			return d.array(t, v)
+		})
+	case kMap:
+		return d.nested(func() error {
+			return d.mapValue(t, v)
+		})
+	case kExt:
+		p, err := d.read(t.n)
+		if err != nil {
+			return err
+		}
+		switch {
+		case v.Type() == extType:
+			v.Set(reflect.ValueOf(Ext{t.ext, append([]byte(nil), p...)}))
+		case v.Type() == timeType && t.ext == -1:
+			tm, err := d.timestamp(p)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(tm))
+		default:
+			return d.typeError(t, v.Type())
+		}
+	}
+	return nil
+}
+
+func (d *decoder) number(t token, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := t.i
+		if t.kind == kFloat || t.kind == kUint && t.u > math.MaxInt64 {
+			return d.typeError(t, v.Type())
+		} else if t.kind == kUint {
+			i = int64(t.u)
+		}
+		if v.OverflowInt(i) {
+			return d.typeError(t, v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := t.u
+		if t.kind == kFloat || t.kind == kInt && t.i < 0 {
+			return d.typeError(t, v.Type())
+		} else if t.kind == kInt {
+			u = uint64(t.i)
+		}
+		if v.OverflowUint(u) {
+			return d.typeError(t, v.Type())
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f := t.f
+		switch t.kind {
+		case kInt:
+			f = float64(t.i)
+		case kUint:
+			f = float64(t.u)
+		}
+		if v.OverflowFloat(f) && !math.IsInf(f, 0) {
+			return d.typeError(t, v.Type())
+		}
+		v.SetFloat(f)
+	default:
+		return d.typeError(t, v.Type())
+	}
+	return nil
+}
+
+func (d *decoder) array(t token, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.IsNil() || v.Cap() < t.n {
+			v.Set(reflect.MakeSlice(v.Type(), t.n, t.n))
+		} else {
+			v.SetLen(t.n)
+		}
+	case reflect.Array:
+	default:
+		return d.typeError(t, v.Type())
+	}
+	for i := 0; i < t.n; i++ {
+		if i >= v.Len() {
+			if err := d.skip(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.value(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	for i := t.n; i < v.Len(); i++ {
+		v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+	}
+	return nil
+}
+
+func (d *decoder) mapValue(t token, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == timeType || v.Type() == extType {
+			return d.typeError(t, v.Type())
+		}
+		a := fields.Of(v.Type(), TagName)
+		for i := 0; i < t.n; i++ {
+			k, err := d.head()
+			if err != nil {
+				return err
+			}
+			if k.kind != kStr {
+				return d.typeError(k, reflect.TypeOf(""))
+			}
+			p, err := d.read(k.n)
+			if err != nil {
+				return err
+			}
+			f := fields.ByName(a, string(p))
+			if f == nil {
+				if err := d.skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			d.fields = append(d.fields, f.Name)
+			if err := d.value(v.FieldByIndex(f.Index)); err != nil {
+				return err
+			}
+			d.fields = d.fields[:len(d.fields)-1]
+		}
+	case reflect.Map:
+		typ := v.Type()
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(typ, t.n))
+		}
+		for i := 0; i < t.n; i++ {
+			off := d.off
+			k := reflect.New(typ.Key()).Elem()
+			if err := d.value(k); err != nil {
+				return err
+			}
+			if k.Kind() == reflect.Interface && !k.IsNil() && !k.Elem().Type().Comparable() {
+				d.off = off
+				return d.syntax("unhashable map key")
+			}
+			e := reflect.New(typ.Elem()).Elem()
+			if err := d.value(e); err != nil {
+				return err
+			}
+			v.SetMapIndex(k, e)
+		}
+	default:
+		return d.typeError(t, v.Type())
+	}
+	return nil
+}
+
+func (d *decoder) timestamp(p []byte) (time.Time, error) {
+	switch len(p) {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(p)), 0), nil
+	case 8:
+		u := binary.BigEndian.Uint64(p)
+		return time.Unix(int64(u&(1<<34-1)), int64(u>>34)), nil
+	case 12:
+		return time.Unix(int64(binary.BigEndian.Uint64(p[4:])), int64(binary.BigEndian.Uint32(p))), nil
+	}
+	return time.Time{}, d.syntax("invalid timestamp")
+}
+
+func (d *decoder) any() (interface{}, error) {
+	t, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch t.kind {
+	case kBool:
+		return t.b, nil
+	case kInt:
+		return t.i, nil
+	case kUint:
+		if t.u <= math.MaxInt64 {
+			return int64(t.u), nil
+		}
+		return t.u, nil
+	case kFloat:
+		return t.f, nil
+	case kStr:
+		p, err := d.read(t.n)
+		return string(p), err
+	case kBin:
+		p, err := d.read(t.n)
+		return append([]byte(nil), p...), err
+	case kExt:
+		p, err := d.read(t.n)
+		if err != nil {
+			return nil, err
+		}
+		if t.ext == -1 {
+			return d.timestamp(p)
+		}
+		return Ext{t.ext, append([]byte(nil), p...)}, nil
+	case kArray:
+		a := make([]interface{}, t.n)
+		err := d.nested(func() error {
+			for i := range a {
+				x, err := d.any()
+				if err != nil {
+					return err
+				}
+				a[i] = x
+			}
+			return nil
+		})
+		return a, err
+	case kMap:
+		var m interface{}
+		err := d.nested(func() error {
+			var err error
+			m, err = d.anyMap(t.n)
+			return err
+		})
+		return m, err
+	}
+	return nil, nil
+}
+
+func (d *decoder) anyMap(n int) (interface{}, error) {
+	m := make(map[string]interface{}, n)
+	var mi map[interface{}]interface{}
+	for i := 0; i < n; i++ {
+		off := d.off
+		k, err := d.any()
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.any()
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := k.(string); ok && mi == nil {
+			m[s] = v
+			continue
+		}
+		if k != nil && !reflect.TypeOf(k).Comparable() {
+			d.off = off
+			return nil, d.syntax("unhashable map key")
+		}
+		if mi == nil {
+			mi = make(map[interface{}]interface{}, n)
+			for s, v := range m {
+				mi[s] = v
+			}
+		}
+		mi[k] = v
+	}
+	if mi != nil {
+		return mi, nil
+	}
+	return m, nil
+}
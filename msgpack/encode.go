@@ -0,0 +1,362 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+// MessagePack, struct fields are tagged like encoding/json with msgpack or json
+package msgpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/cxr29/tiny/internal/fields"
+)
+
+const TagName = "msgpack" // falls back to json
+
+const maxDepth = 10000
+
+var (
+	marshalerType   = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	timeType        = reflect.TypeOf(time.Time{})
+	extType         = reflect.TypeOf(Ext{})
+
+	errDepth = errors.New("msgpack: exceeded max depth")
+)
+
+type Marshaler interface {
+	MarshalMsgPack() ([]byte, error)
+}
+
+type Unmarshaler interface {
+	UnmarshalMsgPack([]byte) error
+}
+
+// extension type, -1 is the timestamp and decoded as time.Time
+type Ext struct {
+	Type int8
+	Data []byte
+}
+
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return "msgpack: unsupported type: " + e.Type.String()
+}
+
+func Marshal(v interface{}) ([]byte, error) {
+	e := new(encoder)
+	if err := e.value(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+type encoder struct {
+	buf   []byte
+	depth int
+}
+
+func (e *encoder) byte(c byte) {
+	e.buf = append(e.buf, c)
+}
+
+func (e *encoder) uint(c byte, u uint64, n int) {
+	e.buf = append(e.buf, c)
+	switch n {
+	case 1:
+		e.buf = append(e.buf, byte(u))
+	case 2:
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(u))
+	case 4:
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(u))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(e.buf, u)
+	}
+}
+
+func (e *encoder) encodeUint(u uint64) {
+	switch {
+	case u <= 0x7f:
+		e.byte(byte(u))
+	case u <= math.MaxUint8:
+		e.uint(0xcc, u, 1)
+	case u <= math.MaxUint16:
+		e.uint(0xcd, u, 2)
+	case u <= math.MaxUint32:
+		e.uint(0xce, u, 4)
+	default:
+		e.uint(0xcf, u, 8)
+	}
+}
+
+func (e *encoder) encodeInt(i int64) {
+	switch {
+	case i >= 0:
+		e.encodeUint(uint64(i))
+	case i >= -32:
+		e.byte(byte(i))
+	case i >= math.MinInt8:
+		e.uint(0xd0, uint64(i), 1)
+	case i >= math.MinInt16:
+		e.uint(0xd1, uint64(i), 2)
+	case i >= math.MinInt32:
+		e.uint(0xd2, uint64(i), 4)
+	default:
+		e.uint(0xd3, uint64(i), 8)
+	}
+}
+
+// fix is the fixed format for lengths below limit, or zero if none
+func (e *encoder) length(n int, fix byte, limit int, c8, c16, c32 byte) {
+	switch {
+	case n < limit:
+		e.byte(fix | byte(n))
+	case c8 != 0 && n <= math.MaxUint8:
+		e.uint(c8, uint64(n), 1)
+	case n <= math.MaxUint16:
+		e.uint(c16, uint64(n), 2)
+	default:
+		e.uint(c32, uint64(n), 4)
+	}
+}
+
+func (e *encoder) encodeString(s string) {
+	e.length(len(s), 0xa0, 32, 0xd9, 0xda, 0xdb)
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) encodeBytes(p []byte) {
+	e.length(len(p), 0, 0, 0xc4, 0xc5, 0xc6)
+	e.buf = append(e.buf, p...)
+}
+
+func (e *encoder) arrayHeader(n int) {
+	e.length(n, 0x90, 16, 0, 0xdc, 0xdd)
+}
+
+func (e *encoder) mapHeader(n int) {
+	e.length(n, 0x80, 16, 0, 0xde, 0xdf)
+}
+
+func (e *encoder) encodeExt(typ int8, p []byte) {
+	switch len(p) {
+	case 1:
+		e.byte(0xd4)
+	case 2:
+		e.byte(0xd5)
+	case 4:
+		e.byte(0xd6)
+	case 8:
+		e.byte(0xd7)
+	case 16:
+		e.byte(0xd8)
+	default:
+		e.length(len(p), 0, 0, 0xc7, 0xc8, 0xc9)
+	}
+	e.buf = append(e.buf, byte(typ))
+	e.buf = append(e.buf, p...)
+}
+
+// timestamp 32, 64 or 96
+func (e *encoder) encodeTime(t time.Time) {
+	sec, nsec := t.Unix(), uint64(t.Nanosecond())
+	switch {
+	case sec >= 0 && sec <= math.MaxUint32 && nsec == 0:
+		e.encodeExt(-1, binary.BigEndian.AppendUint32(nil, uint32(sec)))
+	case sec >= 0 && sec < 1<<34:
+		e.encodeExt(-1, binary.BigEndian.AppendUint64(nil, nsec<<34|uint64(sec)))
+	default:
+		p := binary.BigEndian.AppendUint32(nil, uint32(nsec))
+		e.encodeExt(-1, binary.BigEndian.AppendUint64(p, uint64(sec)))
+	}
+}
+
+func (e *encoder) value(v reflect.Value) error {
+	if !v.IsValid() {
+		e.byte(0xc0)
+		return nil
+	}
+	t := v.Type()
+	if t.Kind() != reflect.Ptr && v.CanAddr() && reflect.PtrTo(t).Implements(marshalerType) {
+		v, t = v.Addr(), v.Addr().Type()
+	}
+	if t.Implements(marshalerType) {
+		if (t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface) && v.IsNil() {
+			e.byte(0xc0)
+			return nil
+		}
+		p, err := v.Interface().(Marshaler).MarshalMsgPack()
+		if err != nil {
+			return err
+		}
+		e.buf = append(e.buf, p...)
+		return nil
+	}
+	switch t {
+	case timeType:
+		e.encodeTime(v.Interface().(time.Time))
+		return nil
+	case extType:
+		x := v.Interface().(Ext)
+		e.encodeExt(x.Type, x.Data)
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.byte(0xc3)
+		} else {
+			e.byte(0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.encodeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.encodeUint(v.Uint())
+	case reflect.Float32:
+		e.uint(0xca, uint64(math.Float32bits(float32(v.Float()))), 4)
+	case reflect.Float64:
+		e.uint(0xcb, math.Float64bits(v.Float()), 8)
+	case reflect.String:
+		e.encodeString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.byte(0xc0)
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			e.encodeBytes(v.Bytes())
+			return nil
+		}
+		return e.array(v)
+	case reflect.Array:
+		return e.array(v)
+	case reflect.Map:
+		if v.IsNil() {
+			e.byte(0xc0)
+			return nil
+		}
+		return e.mapValue(v)
+	case reflect.Struct:
+		return e.structValue(v)
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.byte(0xc0)
+			return nil
+		}
+		return e.nested(func() error {
+			return e.value(v.Elem())
+		})
+	default:
+		return &UnsupportedTypeError{t}
+	}
+	return nil
+}
+
+func (e *encoder) nested(f func() error) error {
+	if e.depth++; e.depth > maxDepth {
+		return errDepth
+	}
+	err := f()
+	e.depth--
+	return err
+}
+
+func (e *encoder) array(v reflect.Value) error {
+	e.arrayHeader(v.Len())
+	return e.nested(func() error {
+		for i := 0; i < v.Len(); i++ {
+			if err := e.value(v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// sorted by the encoded keys
+func (e *encoder) mapValue(v reflect.Value) error {
+	type pair struct {
+		k []byte
+		v reflect.Value
+	}
+	a := make([]pair, 0, v.Len())
+	buf := e.buf
+	err := e.nested(func() error {
+		for it := v.MapRange(); it.Next(); {
+			e.buf = nil
+			if err := e.value(it.Key()); err != nil {
+				return err
+			}
+			a = append(a, pair{e.buf, it.Value()})
+		}
+		return nil
+	})
+	e.buf = buf
+	if err != nil {
+		return err
+	}
+	sort.Slice(a, func(i, j int) bool {
+		return bytes.Compare(a[i].k, a[j].k) < 0
+	})
+	e.mapHeader(len(a))
+	return e.nested(func() error {
+		for _, i := range a {
+			e.buf = append(e.buf, i.k...)
+			if err := e.value(i.v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (e *encoder) structValue(v reflect.Value) error {
+	a := fields.Of(v.Type(), TagName)
+	n := 0
+	for _, f := range a {
+		if !f.OmitEmpty || !isEmpty(v.FieldByIndex(f.Index)) {
+			n++
+		}
+	}
+	e.mapHeader(n)
+	return e.nested(func() error {
+		for _, f := range a {
+			fv := v.FieldByIndex(f.Index)
+			if f.OmitEmpty && isEmpty(fv) {
+				continue
+			}
+			e.encodeString(f.Name)
+			if err := e.value(fv); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,276 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package msgpack
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cxr29/tiny"
+)
+
+func TestMarshal(t *testing.T) {
+	for _, c := range []struct {
+		v interface{}
+		h string
+	}{
+		{nil, "c0"},
+		{false, "c2"},
+		{true, "c3"},
+		{0, "00"},
+		{127, "7f"},
+		{128, "cc80"},
+		{256, "cd0100"},
+		{65536, "ce00010000"},
+		{uint64(1 << 32), "cf0000000100000000"},
+		{-1, "ff"},
+		{-32, "e0"},
+		{-33, "d0df"},
+		{-129, "d1ff7f"},
+		{-32769, "d2ffff7fff"},
+		{int64(math.MinInt64), "d38000000000000000"},
+		{float32(1.5), "ca3fc00000"},
+		{1.5, "cb3ff8000000000000"},
+		{"", "a0"},
+		{"a", "a161"},
+		{strings.Repeat("x", 32), "d920" + strings.Repeat("78", 32)},
+		{[]byte{1}, "c40101"},
+		{[]int{1, 2}, "920102"},
+		{map[string]int{"b": 2, "a": 1}, "82a16101a16202"},
+		{time.Unix(1, 0), "d6ff00000001"},
+		{time.Unix(1, 5), "d7ff0000001400000001"},
+		{time.Unix(-1, 0), "c70cff00000000ffffffffffffffff"},
+		{Ext{5, []byte{1, 2, 3}}, "c70305010203"},
+	} {
+		p, err := Marshal(c.v)
+		if err != nil || hex.EncodeToString(p) != c.h {
+			t.Errorf("Marshal(%#v) = %x, %v, want %s", c.v, p, err, c.h)
+		}
+	}
+}
+
+func TestUnmarshalInterface(t *testing.T) {
+	for _, c := range []struct {
+		h string
+		v interface{}
+	}{
+		{"c0", nil},
+		{"c3", true},
+		{"7f", int64(127)},
+		{"e0", int64(-32)},
+		{"cfffffffffffffffff", uint64(math.MaxUint64)},
+		{"cb3ff8000000000000", 1.5},
+		{"a161", "a"},
+		{"c40101", []byte{1}},
+		{"920102", []interface{}{int64(1), int64(2)}},
+		{"82a16101a16202", map[string]interface{}{"a": int64(1), "b": int64(2)}},
+		{"d6ff00000001", time.Unix(1, 0)},
+	} {
+		p, _ := hex.DecodeString(c.h)
+		var v interface{}
+		if err := Unmarshal(p, &v); err != nil {
+			t.Errorf("%s: %v", c.h, err)
+		} else if tm, ok := v.(time.Time); ok && !tm.Equal(c.v.(time.Time)) || !ok && !reflect.DeepEqual(v, c.v) {
+			t.Errorf("%s: got %#v, want %#v", c.h, v, c.v)
+		}
+	}
+}
+
+type inner struct {
+	Z string `json:"z"`
+}
+
+type record struct {
+	inner
+	A int               `msgpack:"a"`
+	B string            `json:"b,omitempty"`
+	C []byte            `msgpack:"c,omitempty"`
+	D *float32          `json:"d"`
+	E map[string]uint16 `json:"e"`
+	F [2]int8
+	G time.Time
+	I interface{}
+	J bool `json:"-"`
+	L []record
+	M Ext
+}
+
+func TestRoundTrip(t *testing.T) {
+	f := float32(1.25)
+	r := record{
+		inner: inner{"z"},
+		A:     -7,
+		C:     []byte("x"),
+		D:     &f,
+		E:     map[string]uint16{"q": 65535},
+		F:     [2]int8{-1, 1},
+		G:     time.Unix(1700000000, 123),
+		I:     []interface{}{"a", int64(1)},
+		J:     true,
+		L:     []record{{A: 1}},
+		M:     Ext{3, []byte("e")},
+	}
+	p, err := Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r2 record
+	if err := Unmarshal(p, &r2); err != nil {
+		t.Fatal(err)
+	}
+	if !r.G.Equal(r2.G) || !r.L[0].G.Equal(r2.L[0].G) {
+		t.Errorf("time %v, want %v", r2.G, r.G)
+	}
+	r.J = false
+	r2.G, r2.L[0].G = r.G, r.L[0].G
+	if !reflect.DeepEqual(r, r2) {
+		t.Errorf("got %+v, want %+v", r2, r)
+	}
+
+	var m map[string]interface{}
+	if err := Unmarshal(p, &m); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m["b"]; ok || m["z"] != "z" || m["a"] != int64(-7) {
+		t.Errorf("got %#v", m)
+	}
+
+	var bad struct{ L []struct{ A string } }
+	var te *UnmarshalTypeError
+	if err := Unmarshal(p, &bad); !errors.As(err, &te) || te.Field != "L.A" {
+		t.Errorf("got %v, want type error at L.A", err)
+	}
+}
+
+func TestUnmarshalMalformed(t *testing.T) {
+	for _, h := range []string{
+		"",
+		"c1",             // never used
+		"81",             // map without pairs
+		"0000",           // trailing data
+		"dc0005",         // array of 5 without elements
+		"d9ff",           // str8 of 255 without bytes
+		"dbffffffff",     // str32 of 4G
+		"c6ffffffff",     // bin32 of 4G
+		"ddffffffff",     // array32 of 4G
+		"dfffffffff",     // map32 of 4G
+		"c9ffffffff01",   // ext32 of 4G
+		"cfffffff",       // truncated uint64
+		"d7ff0000001400", // truncated timestamp
+		"81c400c0",       // binary map key
+	} {
+		p, _ := hex.DecodeString(h)
+		var v interface{}
+		if err := Unmarshal(p, &v); err == nil {
+			t.Errorf("%s: got %#v, want error", h, v)
+		}
+	}
+}
+
+func TestUnmarshalTruncated(t *testing.T) {
+	p, err := Marshal(map[string]interface{}{
+		"a": []interface{}{int64(1), "two", 3.5, []byte{4}, nil, true},
+		"b": map[string]interface{}{"c": time.Unix(1, 5)},
+		"d": strings.Repeat("x", 300),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(p); i++ {
+		var v interface{}
+		var se *SyntaxError
+		if err := Unmarshal(p[:i], &v); !errors.As(err, &se) {
+			t.Fatalf("%d of %d bytes: got %v, want syntax error", i, len(p), err)
+		}
+	}
+}
+
+func TestDepth(t *testing.T) {
+	p := append(bytes.Repeat([]byte{0x91}, maxDepth), 0xc0)
+	var v interface{}
+	if err := Unmarshal(p, &v); err != nil {
+		t.Errorf("%d nested arrays: %v", maxDepth, err)
+	}
+	p = append(bytes.Repeat([]byte{0x91}, maxDepth+1), 0xc0)
+	if err := Unmarshal(p, &v); err != errDepth {
+		t.Errorf("%d nested arrays: got %v, want %v", maxDepth+1, err, errDepth)
+	}
+
+	var x interface{}
+	for i := 0; i <= maxDepth; i++ {
+		x = []interface{}{x}
+	}
+	if _, err := Marshal(x); err != errDepth {
+		t.Errorf("Marshal: got %v, want %v", err, errDepth)
+	}
+}
+
+func TestContext(t *testing.T) {
+	type item struct {
+		Name string `json:"name"`
+		N    int    `json:"n"`
+	}
+	r := new(tiny.Router)
+	r.GET("/value", func(ctx *tiny.Context) {
+		ctx.WriteValue(item{"a", 1})
+	})
+	r.GET("/write", func(ctx *tiny.Context) {
+		Write(ctx, item{"b", 2})
+	})
+	r.POST("/decode", func(ctx *tiny.Context) error {
+		var v item
+		if err := ctx.Decode(&v); err != nil {
+			return err
+		}
+		_, err := ctx.WriteJSON(v)
+		return err
+	})
+	h := r.Handler()
+	for _, c := range []struct {
+		path string
+		want item
+	}{
+		{"/value", item{"a", 1}},
+		{"/write", item{"b", 2}},
+	} {
+		req := httptest.NewRequest("GET", c.path, nil)
+		req.Header.Set("Accept", MediaType)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		var v item
+		if w.Header().Get("Content-Type") != MediaType {
+			t.Errorf("%s: Content-Type %q", c.path, w.Header().Get("Content-Type"))
+		} else if err := Unmarshal(w.Body.Bytes(), &v); err != nil || v != c.want {
+			t.Errorf("%s: got %+v %v, want %+v", c.path, v, err, c.want)
+		}
+	}
+	good, _ := Marshal(map[string]interface{}{"name": "c", "n": 3})
+	bad, _ := Marshal(map[string]interface{}{"name": "c", "n": "3"})
+	for _, c := range []struct {
+		body   []byte
+		status int
+		want   string
+	}{
+		{good, 200, `{"name":"c","n":3}`},
+		{bad, 400, "n"},
+		{nil, 400, "empty body"},
+		{[]byte{0xc1}, 400, ""},
+	} {
+		req := httptest.NewRequest("POST", "/decode", bytes.NewReader(c.body))
+		req.Header.Set("Content-Type", MediaType)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != c.status || !strings.Contains(w.Body.String(), c.want) {
+			t.Errorf("%x: got %d %s, want %d %s", c.body, w.Code, w.Body, c.status, c.want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package msgpack
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/cxr29/tiny"
+)
+
+const MediaType = "application/msgpack"
+
+var decode = tiny.BinaryDecoder(func(p []byte, v interface{}) error {
+	err := Unmarshal(p, v)
+	var te *UnmarshalTypeError
+	var se *SyntaxError
+	switch {
+	case errors.As(err, &te):
+		return &tiny.DecodeError{Status: http.StatusBadRequest, Field: te.Field, Err: fmt.Errorf("cannot use %s as %s", te.Value, te.Type)}
+	case errors.As(err, &se):
+		return &tiny.DecodeError{Status: http.StatusBadRequest, Err: err}
+	}
+	return err
+})
+
+// registered for negotiation and Context.Decode when imported
+func init() {
+	tiny.RegisterEncoder(MediaType, tiny.BinaryEncoder(Marshal))
+	for _, t := range [...]string{MediaType, "application/x-msgpack", "application/vnd.msgpack"} {
+		tiny.RegisterDecoder(t, decode)
+	}
+}
+
+func Write(ctx *tiny.Context, v interface{}) (int, error) {
+	p, err := Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+	ctx.ContentTypeMsgPack()
+	return ctx.Write(p)
+}
+
+func Decode(ctx *tiny.Context, v interface{}) error {
+	defer ctx.Request.Body.Close()
+	return decode(ctx.Request.Body, v)
+}
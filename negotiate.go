@@ -0,0 +1,232 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cxr29/log"
+)
+
+const (
+	mimeJSON  = "application/json"
+	mimeXML   = "application/xml"
+	mimePlain = "text/plain"
+)
+
+var ErrNotAcceptable = errors.New("not acceptable")
+
+type Encoder func(w io.Writer, v interface{}) error
+
+type encoder struct {
+	mediaType string
+	encode    Encoder
+}
+
+var encoders []encoder
+
+func RegisterEncoder(mediaType string, enc Encoder) {
+	if enc == nil {
+		panic("nil encoder")
+	}
+	mediaType = strings.ToLower(mediaType)
+	for i := range encoders {
+		if encoders[i].mediaType == mediaType {
+			encoders[i].encode = enc
+			return
+		}
+	}
+	encoders = append(encoders, encoder{mediaType, enc})
+}
+
+type mediaRange struct {
+	typ, sub string
+	params   map[string]string
+	q        float64
+}
+
+func parseMediaType(s string) (r mediaRange, ok bool) {
+	a := strings.Split(s, ";")
+	t := strings.ToLower(strings.TrimSpace(a[0]))
+	i := strings.IndexByte(t, '/')
+	if i <= 0 || i == len(t)-1 {
+		return
+	}
+	r.typ, r.sub, r.q = t[:i], t[i+1:], 1
+	if r.typ == "*" && r.sub != "*" {
+		return
+	}
+	for _, p := range a[1:] {
+		i := strings.IndexByte(p, '=')
+		if i == -1 {
+			continue
+		}
+		k := strings.ToLower(strings.TrimSpace(p[:i]))
+		v := strings.Trim(strings.TrimSpace(p[i+1:]), `"`)
+		if k == "q" {
+			q, err := strconv.ParseFloat(v, 64)
+			if err != nil || q < 0 || q > 1 {
+				return
+			}
+			r.q = q
+			break // accept-ext follows
+		}
+		if r.params == nil {
+			r.params = make(map[string]string, 2)
+		}
+		r.params[k] = v
+	}
+	ok = true
+	return
+}
+
+func parseAccept(s string) (a []mediaRange) {
+	for _, s := range strings.Split(s, ",") {
+		if r, ok := parseMediaType(s); ok {
+			a = append(a, r)
+		}
+	}
+	return
+}
+
+// -1 no match, otherwise the larger the more specific
+func (r mediaRange) match(offer mediaRange) int {
+	if r.typ == "*" {
+		return 0
+	}
+	if r.typ != offer.typ {
+		return -1
+	}
+	if r.sub == "*" {
+		return 1
+	}
+	if r.sub != offer.sub {
+		return -1
+	}
+	for k, v := range r.params {
+		if !strings.EqualFold(offer.params[k], v) {
+			return -1
+		}
+	}
+	return 2 + len(r.params)
+}
+
+func (ctx *Context) Negotiate(offers ...string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	s := strings.Join(ctx.Request.Header["Accept"], ",")
+	if strings.TrimSpace(s) == "" {
+		return offers[0]
+	}
+	accept := parseAccept(s)
+	var best string
+	var bestQ float64
+	for _, offer := range offers {
+		o, ok := parseMediaType(offer)
+		if !ok {
+			continue
+		}
+		q, specificity := 0.0, -1
+		for _, r := range accept {
+			if i := r.match(o); i > specificity {
+				q, specificity = r.q, i
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+func (ctx *Context) Vary(keys ...string) {
+	h := ctx.Header()
+Loop:
+	for _, k := range keys {
+		for _, v := range h["Vary"] {
+			for _, s := range strings.Split(v, ",") {
+				if s = strings.TrimSpace(s); s == "*" || strings.EqualFold(s, k) {
+					continue Loop
+				}
+			}
+		}
+		h.Add("Vary", k)
+	}
+}
+
+// other values, fmt.Stringer included, are offered as structured data only
+func isText(v interface{}) bool {
+	switch v.(type) {
+	case string, []byte, error:
+		return true
+	}
+	return false
+}
+
+func encodeText(w io.Writer, v interface{}) (err error) {
+	switch v := v.(type) {
+	case []byte:
+		_, err = w.Write(v)
+	default:
+		_, err = fmt.Fprint(w, v)
+	}
+	return
+}
+
+func (ctx *Context) WriteValue(v interface{}) (int, error) {
+	return ctx.Respond(http.StatusOK, v)
+}
+
+func (ctx *Context) Respond(code int, v interface{}) (int, error) {
+	offers := make([]string, 0, 3+len(encoders))
+	if isText(v) {
+		offers = append(offers, mimePlain)
+	}
+	offers = append(offers, mimeJSON, mimeXML)
+	for _, e := range encoders {
+		offers = append(offers, e.mediaType)
+	}
+	ctx.Vary("Accept")
+	t := ctx.Negotiate(offers...)
+	var b bytes.Buffer
+	var err error
+	switch t {
+	case "":
+		ctx.errorStatus(http.StatusNotAcceptable)
+		return 0, ErrNotAcceptable
+	case mimePlain:
+		err = encodeText(&b, v)
+		t += "; charset=utf-8"
+	case mimeJSON:
+		err = json.NewEncoder(&b).Encode(v)
+		t += "; charset=utf-8"
+	case mimeXML:
+		err = xml.NewEncoder(&b).Encode(v)
+		t += "; charset=utf-8"
+	default:
+		for _, e := range encoders {
+			if e.mediaType == t {
+				err = e.encode(&b, v)
+				break
+			}
+		}
+	}
+	if err != nil {
+		log.Warningln(err)
+		return 0, err
+	}
+	ctx.ContentType(t)
+	ctx.WriteHeader(code)
+	return ctx.Write(b.Bytes())
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serveRespond(accept string, v interface{}) (*httptest.ResponseRecorder, error) {
+	var err error
+	r := new(Router)
+	r.GET("/", func(ctx *Context) {
+		_, err = ctx.WriteValue(v)
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, req)
+	return w, err
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, c := range []struct {
+		accept string
+		offers []string
+		want   string
+	}{
+		{"", []string{"text/plain", "application/json"}, "text/plain"},
+		{"*/*", []string{"text/plain", "application/json"}, "text/plain"},
+		{"application/json, */*;q=0.1", []string{"text/plain", "application/json"}, "application/json"},
+		{"text/*;q=0.5, application/xml", []string{"text/plain", "application/xml"}, "application/xml"},
+		{"text/plain;q=0, */*", []string{"text/plain", "application/json"}, "application/json"},
+		{"text/html;level=1", []string{"text/html", "text/html;level=1"}, "text/html;level=1"},
+		{"image/png", []string{"text/plain", "application/json"}, ""},
+		{"application/json;q=2", []string{"application/json"}, ""},
+	} {
+		r := new(Router)
+		var got string
+		r.GET("/", func(ctx *Context) {
+			got = ctx.Negotiate(c.offers...)
+		})
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", c.accept)
+		r.Handler().ServeHTTP(httptest.NewRecorder(), req)
+		if got != c.want {
+			t.Errorf("%q: got %q, want %q", c.accept, got, c.want)
+		}
+	}
+}
+
+func TestRespond(t *testing.T) {
+	RegisterEncoder("application/x-test", func(w io.Writer, v interface{}) error {
+		_, err := io.WriteString(w, "test")
+		return err
+	})
+	tm := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		accept      string
+		v           interface{}
+		contentType string
+		body        string
+	}{
+		{"*/*", "hi", "text/plain; charset=utf-8", "hi"},
+		{"*/*", []byte("hi"), "text/plain; charset=utf-8", "hi"},
+		{"*/*", errors.New("oops"), "text/plain; charset=utf-8", "oops"},
+		{"*/*", tm, "application/json; charset=utf-8", `"2020-01-02T00:00:00Z"` + "\n"},
+		{"", map[string]int{"a": 1}, "application/json; charset=utf-8", `{"a":1}` + "\n"},
+		{"application/json", "hi", "application/json; charset=utf-8", `"hi"` + "\n"},
+		{"application/xml", decodeItem{"a", 1}, "application/xml; charset=utf-8", "<decodeItem><name>a</name><count>1</count></decodeItem>"},
+		{"application/x-test", 1, "application/x-test", "test"},
+	} {
+		w, err := serveRespond(c.accept, c.v)
+		if err != nil {
+			t.Errorf("%q %T: %v", c.accept, c.v, err)
+			continue
+		}
+		if s := w.Header().Get("Content-Type"); s != c.contentType {
+			t.Errorf("%q %T: content type %q, want %q", c.accept, c.v, s, c.contentType)
+		}
+		if s := w.Body.String(); s != c.body {
+			t.Errorf("%q %T: body %q, want %q", c.accept, c.v, s, c.body)
+		}
+		if s := w.Header().Get("Vary"); s != "Accept" {
+			t.Errorf("%q %T: vary %q", c.accept, c.v, s)
+		}
+	}
+}
+
+func TestNotAcceptable(t *testing.T) {
+	w, err := serveRespond("text/plain", 1)
+	if err != ErrNotAcceptable {
+		t.Errorf("got %v", err)
+	}
+	if w.Code != 406 {
+		t.Errorf("status %d", w.Code)
+	}
+	if s := w.Header().Get("Content-Type"); !strings.HasPrefix(s, "text/plain") {
+		t.Errorf("content type %q", s)
+	}
+}
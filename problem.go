@@ -0,0 +1,262 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/cxr29/log"
+)
+
+const (
+	mimeProblemJSON = "application/problem+json"
+	mimeProblemXML  = "application/problem+xml"
+	mimeHTML        = "text/html"
+	problemXMLNS    = "urn:ietf:rfc:7807"
+)
+
+// RFC 9457, extensions are flattened into the members
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]interface{}
+}
+
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" || p.Title == "" {
+		return p.Title + p.Detail
+	}
+	return p.Title + ": " + p.Detail
+}
+
+func (p *Problem) StatusCode() int {
+	return p.Status
+}
+
+func (p *Problem) members() map[string]interface{} {
+	m := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	for _, i := range [...]struct {
+		k  string
+		v  interface{}
+		ok bool
+	}{
+		{"type", p.Type, p.Type != ""},
+		{"title", p.Title, p.Title != ""},
+		{"status", p.Status, p.Status != 0},
+		{"detail", p.Detail, p.Detail != ""},
+		{"instance", p.Instance, p.Instance != ""},
+	} {
+		if i.ok {
+			m[i.k] = i.v
+		} else {
+			delete(m, i.k)
+		}
+	}
+	return m
+}
+
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.members())
+}
+
+func (p *Problem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{Name: xml.Name{Space: problemXMLNS, Local: "problem"}}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	m := p.members()
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := encodeXMLMember(e, k, m[k]); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// arrays are wrapped with the items in i elements
+func encodeXMLMember(e *xml.Encoder, k string, v interface{}) error {
+	el := xml.StartElement{Name: xml.Name{Local: k}}
+	if rv := reflect.ValueOf(v); (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) &&
+		rv.Type().Elem().Kind() != reflect.Uint8 {
+		if err := e.EncodeToken(el); err != nil {
+			return err
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := encodeXMLMember(e, "i", rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(el.End())
+	}
+	if err := e.EncodeElement(v, el); err != nil {
+		return e.EncodeElement(fmt.Sprint(v), el)
+	}
+	return nil
+}
+
+var errorPage = template.Must(template.New("").Parse(`<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Status}} {{.Title}}</title>
+</head>
+<body>
+<h1>{{.Status}} {{.Title}}</h1>
+{{with .Detail}}<p>{{.}}</p>
+{{end}}</body>
+</html>
+`))
+
+type ErrorFormatter func(*Context, *Problem)
+
+func (r *Router) FormatError(f func(*Context, *Problem)) {
+	if r.above != nil {
+		panic("error formatter on subrouter")
+	}
+	r.formatError = f
+}
+
+// problem+json unless problem+xml, html or plain text is preferred
+func DefaultErrorFormatter(ctx *Context, p *Problem) {
+	var b bytes.Buffer
+	var err error
+	ctx.Vary("Accept")
+	switch t := ctx.Negotiate(mimeProblemJSON, mimeJSON, mimeProblemXML, mimeXML, mimeHTML, mimePlain); t {
+	case mimeProblemXML, mimeXML:
+		ctx.utf8ContentType(mimeProblemXML)
+		b.WriteString(xml.Header)
+		err = xml.NewEncoder(&b).Encode(p)
+	case mimeHTML:
+		ctx.ContentTypeHTML()
+		err = errorPage.Execute(&b, p)
+	case mimePlain:
+		ctx.ContentTypePlain()
+		b.WriteString(p.Error() + "\n")
+		if list, ok := p.Extensions["errors"].(interface{ Unwrap() []error }); ok {
+			for _, e := range list.Unwrap() {
+				b.WriteString(e.Error() + "\n")
+			}
+		}
+	default:
+		ctx.utf8ContentType(mimeProblemJSON)
+		err = json.NewEncoder(&b).Encode(p)
+	}
+	if err != nil {
+		log.Warningln(err)
+		b.Reset()
+		ctx.ContentTypePlain()
+		b.WriteString(p.Error() + "\n")
+	}
+	h := ctx.Header()
+	h.Del("Content-Length")
+	h.Set("X-Content-Type-Options", "nosniff")
+	if p.Status > 0 {
+		ctx.WriteHeader(p.Status)
+	}
+	ctx.Write(b.Bytes())
+}
+
+func (ctx *Context) WriteProblem(p *Problem) {
+	if ctx.servePage(p) {
+		return
+	}
+	var f ErrorFormatter
+	if ctx.tree != nil {
+		f = ctx.tree.formatError
+	}
+	if f == nil {
+		f = DefaultErrorFormatter
+	}
+	f(ctx, p)
+}
+
+func (r *Router) ErrorPage(code int, handler interface{}) {
+	if r.above != nil {
+		panic("error page on subrouter")
+	}
+	if r.errorPages == nil {
+		r.errorPages = make(map[int]Handler, 10)
+	}
+	r.errorPages[code] = newHandler(handler)
+}
+
+// the problem of the error page being served
+func (ctx *Context) Problem() *Problem {
+	return ctx.page
+}
+
+// fall back to the formatter if the page wrote nothing, pages are not nested
+func (ctx *Context) servePage(p *Problem) bool {
+	if ctx.page != nil || ctx.tree == nil {
+		return false
+	}
+	h := ctx.tree.errorPages[p.Status]
+	if h == nil {
+		return false
+	}
+	ctx.page = p
+	defer func() {
+		ctx.page = nil
+	}()
+	h.ServeHTTP(ctx)
+	return ctx.wroteHeader
+}
+
+func (ctx *Context) implicitStatus() int {
+	if ctx.page != nil && ctx.page.Status > 0 {
+		return ctx.page.Status
+	}
+	return http.StatusOK
+}
+
+type headerRecorder http.Header
+
+func (h headerRecorder) Header() http.Header {
+	return http.Header(h)
+}
+
+func (h headerRecorder) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (h headerRecorder) WriteHeader(int) {}
+
+func (ctx *Context) Redirect(location string, code int) {
+	if ctx.page == nil && ctx.tree != nil && ctx.tree.errorPages[code] != nil {
+		h := make(headerRecorder)
+		http.Redirect(h, ctx.Request, location, code)
+		ctx.Header().Set("Location", http.Header(h).Get("Location"))
+		if ctx.servePage(NewProblem(code, "")) {
+			return
+		}
+	}
+	http.Redirect(ctx, ctx.Request, location, code)
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package recover
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"runtime/debug"
+	"sort"
+
+	"github.com/cxr29/log"
+	"github.com/cxr29/tiny"
+	"github.com/cxr29/tiny/access"
+)
+
+type Options struct {
+	Report func(ctx *tiny.Context, id string, err interface{}, stack []byte)
+}
+
+var DefaultOptions = &Options{}
+
+type Panic struct {
+	ID    string
+	Value interface{}
+	Stack []byte
+}
+
+func (p *Panic) Error() string {
+	return fmt.Sprintf("panic %s: %v", p.ID, p.Value)
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		log.ErrError(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func New(o *Options) tiny.HandlerFunc {
+	if o == nil {
+		o = DefaultOptions
+	}
+	return func(ctx *tiny.Context) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			} else if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			p := &Panic{newID(), err, debug.Stack()}
+			log.Errorf("%v\n%s", p, p.Stack)
+			if a, ok := access.Lookup(ctx); ok {
+				a.Set("panic", true)
+			}
+			if o.Report != nil {
+				o.Report(ctx, p.ID, p.Value, p.Stack)
+			}
+			if ctx.WroteHeader() {
+				if b := ctx.Buffered(); b == nil || !b.Reset() {
+					return
+				}
+			}
+			ctx.Header().Set("X-Error-Id", p.ID)
+			if tiny.Dev() {
+				writePage(ctx, p)
+			} else {
+				ctx.Error(&tiny.HTTPError{
+					Code:    http.StatusInternalServerError,
+					Message: http.StatusText(http.StatusInternalServerError) + " (" + p.ID + ")",
+					Err:     p,
+				})
+			}
+		}()
+		ctx.Next()
+	}
+}
+
+type param struct {
+	Name, Value string
+}
+
+type header struct {
+	Name   string
+	Values []string
+}
+
+var page = template.Must(template.New("panic").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>panic: {{.Value}}</title>
+<style>
+body{font:14px/1.5 sans-serif;margin:2em;color:#222}
+h1{color:#c00;font-size:1.4em}
+pre{background:#f6f6f6;padding:1em;overflow:auto}
+table{border-collapse:collapse}
+td,th{border:1px solid #ddd;padding:.2em .6em;text-align:left;vertical-align:top}
+</style>
+</head>
+<body>
+<h1>panic: {{.Value}}</h1>
+<p>Error ID: <code>{{.ID}}</code></p>
+<h2>Route</h2>
+<table>
+<tr><th>Request</th><td>{{.Method}} {{.URI}}</td></tr>
+<tr><th>Pattern</th><td>{{if .Pattern}}{{.Pattern}}{{else}}<em>not routed</em>{{end}}</td></tr>
+{{if .Name}}<tr><th>Name</th><td>{{.Name}}</td></tr>{{end}}
+</table>
+{{if .Params}}<h2>Params</h2>
+<table>
+{{range .Params}}<tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>
+{{end}}</table>{{end}}
+<h2>Stack</h2>
+<pre>{{.Stack}}</pre>
+<h2>Request Headers</h2>
+<table>
+{{range .Headers}}<tr><th>{{.Name}}</th><td>{{range .Values}}{{.}}<br>{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func writePage(ctx *tiny.Context, p *Panic) {
+	var params []param
+	for i, s := range ctx.ParamNames() {
+		if i < len(ctx.Params) {
+			params = append(params, param{s, ctx.Params[i]})
+		}
+	}
+	headers := make([]header, 0, len(ctx.Request.Header))
+	for k, v := range ctx.Request.Header {
+		headers = append(headers, header{k, v})
+	}
+	sort.Slice(headers, func(i, j int) bool {
+		return headers[i].Name < headers[j].Name
+	})
+	ctx.ContentTypeHTML()
+	ctx.WriteHeader(http.StatusInternalServerError)
+	log.ErrError(page.Execute(ctx, map[string]interface{}{
+		"ID":      p.ID,
+		"Value":   fmt.Sprint(p.Value),
+		"Stack":   string(p.Stack),
+		"Method":  ctx.Request.Method,
+		"URI":     ctx.Request.RequestURI,
+		"Pattern": ctx.Pattern(),
+		"Name":    ctx.RouteName(),
+		"Params":  params,
+		"Headers": headers,
+	}))
+}
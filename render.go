@@ -0,0 +1,40 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"bytes"
+	"io"
+)
+
+type Renderer interface {
+	Render(w io.Writer, name string, data interface{}) error
+}
+
+func (r *Router) SetRenderer(x Renderer) {
+	if r.above != nil {
+		panic("renderer on subrouter")
+	}
+	r.renderer = x
+}
+
+// rendered into a buffer first, nothing is written if it fails
+func (ctx *Context) Render(code int, name string, data interface{}) error {
+	if ctx.tree.renderer == nil {
+		panic("no renderer")
+	}
+	var b bytes.Buffer
+	if err := ctx.tree.renderer.Render(&b, name, data); err != nil {
+		return err
+	}
+	if ctx.Header().Get(contentType) == "" {
+		ctx.ContentTypeHTML()
+	}
+	if code > 0 {
+		ctx.WriteHeader(code)
+	}
+	_, err := ctx.Write(b.Bytes())
+	return err
+}
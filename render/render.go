@@ -0,0 +1,162 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package render
+
+import (
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/cxr29/tiny"
+	"github.com/cxr29/tiny/assets"
+)
+
+type Options struct {
+	Ext      string
+	Layouts  string // directory of layouts, shared by all pages
+	Partials string // directory of partials, shared by all pages and rendered without layout
+	Layout   string // default layout pages are executed through, none if empty
+	Funcs    template.FuncMap
+	Router   *tiny.Router
+	Assets   *assets.Assets
+}
+
+var DefaultOptions = &Options{
+	Ext:      ".html",
+	Layouts:  "layouts",
+	Partials: "partials",
+}
+
+var ErrNotFound = errors.New("render: template not found")
+
+type Renderer struct {
+	fsys  fs.FS
+	o     *Options
+	dev   bool
+	pages map[string]*template.Template
+}
+
+func New(fsys fs.FS, o *Options) *Renderer {
+	if o == nil {
+		o = DefaultOptions
+	}
+	r := &Renderer{
+		fsys: fsys,
+		o:    o,
+		dev:  tiny.Dev(),
+	}
+	if !r.dev {
+		pages, err := r.parse("")
+		if err != nil {
+			panic(err)
+		}
+		r.pages = pages
+	}
+	return r
+}
+
+func (r *Renderer) funcs() template.FuncMap {
+	m := template.FuncMap{
+		"url": func(name string, params ...interface{}) string {
+			if r.o.Router != nil {
+				return r.o.Router.URL(name, params...)
+			}
+			return tiny.URL(name, params...)
+		},
+		"asset": func(name string) string {
+			if r.o.Assets != nil {
+				return r.o.Assets.URL(name)
+			}
+			return assets.URL(name)
+		},
+	}
+	for k, v := range r.o.Funcs {
+		m[k] = v
+	}
+	return m
+}
+
+func inDir(name, dir string) bool {
+	return dir != "" && strings.HasPrefix(name, dir+"/")
+}
+
+// parse the shared templates and the page, or all the pages if empty
+func (r *Renderer) parse(page string) (map[string]*template.Template, error) {
+	var shared, names []string
+	err := fs.WalkDir(r.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Ext(name) != r.o.Ext {
+			return err
+		}
+		if inDir(name, r.o.Layouts) || inDir(name, r.o.Partials) {
+			shared = append(shared, name)
+		} else if page == "" || page == name {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	base := template.New("").Funcs(r.funcs())
+	for _, name := range shared {
+		if err := r.parseFile(base, name); err != nil {
+			return nil, err
+		}
+	}
+	pages := make(map[string]*template.Template, len(names)+len(shared))
+	for _, name := range shared {
+		if inDir(name, r.o.Partials) {
+			pages[name] = base
+		}
+	}
+	for _, name := range names {
+		t, err := base.Clone()
+		if err == nil {
+			err = r.parseFile(t, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		pages[name] = t
+	}
+	return pages, nil
+}
+
+func (r *Renderer) parseFile(t *template.Template, name string) error {
+	p, err := fs.ReadFile(r.fsys, name)
+	if err == nil {
+		_, err = t.New(name).Parse(string(p))
+	}
+	return err
+}
+
+func (r *Renderer) lookup(name string) (*template.Template, error) {
+	if r.dev {
+		pages, err := r.parse(name)
+		if err != nil {
+			return nil, err
+		}
+		return pages[name], nil
+	}
+	return r.pages[name], nil
+}
+
+func (r *Renderer) Render(w io.Writer, name string, data interface{}) error {
+	t, err := r.lookup(name)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return ErrNotFound
+	}
+	entry := name
+	if r.o.Layout != "" && !inDir(name, r.o.Partials) {
+		entry = path.Join(r.o.Layouts, r.o.Layout)
+	}
+	return t.ExecuteTemplate(w, entry, data)
+}
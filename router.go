@@ -10,12 +10,19 @@ type Route struct {
 	tags         []Tag
 	above, below *Router
 	index        int
+	skips        []string
+	meta         map[string]interface{}
 }
 
 type Router struct {
-	routes   []*Route
-	handlers []Handler
-	above    *Route
+	routes      []*Route
+	handlers    []Handler
+	above       *Route
+	onError     ErrorHandler
+	skips       []string
+	renderer    Renderer
+	formatError ErrorFormatter
+	errorPages  map[int]Handler
 }
 
 func (r *Router) Fallback() {
@@ -0,0 +1,102 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+)
+
+type SPAOptions struct {
+	Prefix        string
+	Exclude       []string
+	Hashed        *regexp.Regexp // assets matched are immutable
+	Precompressed bool
+}
+
+var DefaultSPAOptions = &SPAOptions{
+	Hashed:        regexp.MustCompile(`[.-][0-9A-Fa-f]{8,}\.[0-9A-Za-z]+$`),
+	Precompressed: true,
+}
+
+// instead of Fallback, the index is served for unmatched GET and HEAD requests that accept html
+func (r *Router) FallbackSPA(fsys fs.FS, index string, o *SPAOptions) {
+	r.Use(
+		HandleNotImplemented,
+		NewRedirectTrailingSlash(true),
+		NewRedirectCleanedPath(true),
+		NewAllowedMethods(false),
+		SPA(fsys, index, o),
+		NewAllowedMethods(true),
+	)
+}
+
+// after NewAllowedMethods(false) and before HandleNotFound, see FallbackSPA
+func SPA(fsys fs.FS, index string, o *SPAOptions) Handler {
+	if o == nil {
+		o = DefaultSPAOptions
+	}
+	if !fs.ValidPath(index) {
+		panic("malformed index: " + index)
+	}
+	prefix := strings.TrimSuffix(o.Prefix, "/")
+	static := &StaticOptions{Precompressed: o.Precompressed}
+	return HandlerFunc(func(ctx *Context) {
+		if ctx.Routed() || ctx.WroteHeader() || ctx.Header().Get("Allow") != "" ||
+			!isGetOrHead(ctx.Request.Method) {
+			return
+		}
+		p := ctx.Request.URL.Path
+		if !strings.HasPrefix(p, prefix+"/") && p != prefix {
+			return
+		}
+		for _, s := range o.Exclude {
+			if strings.HasPrefix(p, s) {
+				return
+			}
+		}
+		name := strings.Trim(p[len(prefix):], "/")
+		if name != "" && fs.ValidPath(name) && !isDotPath(name) {
+			if f, fi, err := openStat(fsys, name); err == nil {
+				defer f.Close()
+				if !fi.IsDir() {
+					if o.Hashed != nil && o.Hashed.MatchString(name) {
+						ctx.MaxAge(365 * 24 * 60 * 60)
+						ctx.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+					}
+					static.serveFile(ctx, fsys, name, f, fi)
+					return
+				}
+			}
+		}
+		if path.Ext(name) != "" {
+			ctx.NotFound()
+			return
+		}
+		ctx.Vary("Accept")
+		if !acceptsHTML(ctx.Request.Header.Get("Accept")) {
+			return
+		}
+		f, fi, err := openStat(fsys, index)
+		if err != nil {
+			statusError(ctx, err)
+			return
+		}
+		defer f.Close()
+		ctx.Header().Set("Cache-Control", "no-cache")
+		static.serveFile(ctx, fsys, index, f, fi)
+	})
+}
+
+func acceptsHTML(s string) bool {
+	for _, r := range parseAccept(s) {
+		if r.typ == "text" && (r.sub == "html" || r.sub == "*") && r.q > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSPA(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":         {Data: []byte("<html>")},
+		"app.js":             {Data: []byte("js")},
+		"app.0123abcd.js":    {Data: []byte("hashed")},
+		".env":               {Data: []byte("secret")},
+		"assets/logo.svg":    {Data: []byte("<svg>")},
+		"assets/nested/a.js": {Data: []byte("a")},
+	}
+	r := new(Router)
+	r.GET("/api/users", func(ctx *Context) {
+		ctx.WriteString("users")
+	})
+	r.FallbackSPA(fsys, "index.html", &SPAOptions{Exclude: []string{"/api/"}, Hashed: DefaultSPAOptions.Hashed})
+	h := r.Handler()
+	for _, c := range []struct {
+		method, path, accept string
+		status               int
+		body                 string
+	}{
+		{"GET", "/", "text/html", 200, "<html>"},
+		{"GET", "/users/1", "text/html,*/*;q=0.8", 200, "<html>"},
+		{"GET", "/users/1", "application/json", 404, ""},
+		{"GET", "/app.js", "", 200, "js"},
+		{"GET", "/app.0123abcd.js", "", 200, "hashed"},
+		{"GET", "/assets/nested/a.js", "", 200, "a"},
+		{"GET", "/missing.js", "text/html", 404, ""},
+		{"GET", "/.env", "text/html", 404, ""},
+		{"GET", "/api/missing", "text/html", 404, ""},
+		{"GET", "/api/users", "text/html", 200, "users"},
+	} {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		if c.accept != "" {
+			req.Header.Set("Accept", c.accept)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != c.status {
+			t.Errorf("%s %s %s: status %d, want %d", c.method, c.path, c.accept, w.Code, c.status)
+			continue
+		}
+		if c.body != "" && w.Body.String() != c.body {
+			t.Errorf("%s %s: got %q, want %q", c.method, c.path, w.Body, c.body)
+		}
+		if c.path == "/users/1" && !strings.Contains(strings.Join(w.Header().Values("Vary"), ","), "Accept") {
+			t.Errorf("%s %s %s: no Vary: Accept", c.method, c.path, c.accept)
+		}
+		cc := w.Header().Get("Cache-Control")
+		switch {
+		case c.path == "/app.0123abcd.js" && !strings.Contains(cc, "immutable"):
+			t.Errorf("%s: Cache-Control %q", c.path, cc)
+		case c.body == "<html>" && cc != "no-cache":
+			t.Errorf("%s: Cache-Control %q", c.path, cc)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type StaticOptions struct {
+	Index         string
+	Listing       bool
+	Dotfiles      bool
+	Precompressed bool
+	MaxAge        map[string]int  // seconds by extension, "" for the rest
+	Immutable     map[string]bool // by extension
+}
+
+var DefaultStaticOptions = &StaticOptions{
+	Index:         "index.html",
+	Precompressed: true,
+}
+
+var precompressed = [...]struct{ encoding, ext string }{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+func (r *Router) Static(prefix string, fsys fs.FS, o *StaticOptions) {
+	h := NewStatic(fsys, o)
+	r.Group(prefix, func(r *Router) {
+		for _, p := range [...]string{"/", "/<path:str>"} {
+			r.GET(p, h)
+			r.HEAD(p, h)
+		}
+	})
+}
+
+func NewStatic(fsys fs.FS, o *StaticOptions) HandlerFunc {
+	if o == nil {
+		o = DefaultStaticOptions
+	}
+	return func(ctx *Context) {
+		name := strings.TrimSuffix(ctx.Param("path"), "/")
+		if name == "" {
+			name = "."
+		}
+		if !fs.ValidPath(name) || strings.ContainsAny(name, "\\\x00") || !o.Dotfiles && isDotPath(name) {
+			ctx.NotFound()
+			return
+		}
+		o.serve(ctx, fsys, name)
+	}
+}
+
+func isDotPath(name string) bool {
+	for _, s := range strings.Split(name, "/") {
+		if len(s) > 1 && s[0] == '.' {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *StaticOptions) serve(ctx *Context, fsys fs.FS, name string) {
+	f, fi, err := openStat(fsys, name)
+	if err != nil {
+		statusError(ctx, err)
+		return
+	}
+	defer f.Close()
+	if !fi.IsDir() {
+		o.serveFile(ctx, fsys, name, f, fi)
+		return
+	}
+	if p := ctx.Request.URL.Path; !hasTrailingSlash(p) {
+		u := *ctx.Request.URL
+		u.Path = p + "/"
+		ctx.MovedPermanently(u.String())
+		return
+	}
+	if o.Index != "" {
+		index := path.Join(name, o.Index)
+		if f, fi, err := openStat(fsys, index); err == nil {
+			defer f.Close()
+			if !fi.IsDir() {
+				o.serveFile(ctx, fsys, index, f, fi)
+				return
+			}
+		}
+	}
+	if !o.Listing {
+		ctx.NotFound()
+		return
+	}
+	o.list(ctx, fsys, name)
+}
+
+func openStat(fsys fs.FS, name string) (fs.File, fs.FileInfo, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, fi, nil
+}
+
+func statusError(ctx *Context, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		ctx.NotFound()
+	case errors.Is(err, fs.ErrPermission):
+		ctx.Forbidden()
+	default:
+		ctx.Error(err)
+	}
+}
+
+func (o *StaticOptions) serveFile(ctx *Context, fsys fs.FS, name string, f fs.File, fi fs.FileInfo) {
+	h := ctx.Header()
+	ext := strings.ToLower(path.Ext(name))
+	o.cacheControl(ctx, ext)
+	if o.Precompressed {
+		ctx.Vary("Accept-Encoding")
+		ae := ctx.Request.Header.Get("Accept-Encoding")
+		for _, i := range precompressed {
+			if !acceptsEncoding(ae, i.encoding) {
+				continue
+			}
+			cf, cfi, err := openStat(fsys, name+i.ext)
+			if err != nil {
+				continue
+			}
+			defer cf.Close()
+			if cfi.IsDir() {
+				continue
+			}
+			if ct := mime.TypeByExtension(ext); ct != "" {
+				h.Set(contentType, ct)
+			} else {
+				h.Set(contentType, "application/octet-stream")
+			}
+			h.Set("Content-Encoding", i.encoding)
+			f, fi = cf, cfi
+			break
+		}
+	}
+	content, err := readSeeker(f, fi)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	ctx.ServeContent(path.Base(name), fi.ModTime(), content)
+}
+
+func (o *StaticOptions) cacheControl(ctx *Context, ext string) {
+	if o.Immutable[ext] {
+		ctx.MaxAge(365 * 24 * 60 * 60)
+		ctx.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else if seconds, ok := o.MaxAge[ext]; ok {
+		ctx.MaxAge(seconds)
+	} else if seconds, ok := o.MaxAge[""]; ok {
+		ctx.MaxAge(seconds)
+	}
+}
+
+func readSeeker(f fs.File, fi fs.FileInfo) (io.ReadSeeker, error) {
+	if rs, ok := f.(io.ReadSeeker); ok {
+		return rs, nil
+	}
+	if ra, ok := f.(io.ReaderAt); ok {
+		return io.NewSectionReader(ra, 0, fi.Size()), nil
+	}
+	p, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(p), nil
+}
+
+// the coding is acceptable if listed, or covered by * without a zero quality
+func acceptsEncoding(header, coding string) bool {
+	star := false
+	for _, s := range strings.Split(header, ",") {
+		a := strings.Split(s, ";")
+		c := strings.ToLower(strings.TrimSpace(a[0]))
+		if c != coding && c != "*" {
+			continue
+		}
+		q := 1.0
+		for _, p := range a[1:] {
+			if p = strings.TrimSpace(p); strings.HasPrefix(p, "q=") {
+				q, _ = strconv.ParseFloat(p[2:], 64)
+			}
+		}
+		if c == coding {
+			return q > 0
+		}
+		star = q > 0
+	}
+	return star
+}
+
+func (o *StaticOptions) list(ctx *Context, fsys fs.FS, name string) {
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		statusError(ctx, err)
+		return
+	}
+	var b bytes.Buffer
+	title := html.EscapeString(ctx.Request.URL.Path)
+	fmt.Fprintf(&b, "<!doctype html>\n<title>%s</title>\n<h1>%s</h1>\n<pre>\n", title, title)
+	for _, e := range entries {
+		s := e.Name()
+		if !o.Dotfiles && s[0] == '.' {
+			continue
+		}
+		if e.IsDir() {
+			s += "/"
+		}
+		u := url.URL{Path: s}
+		fmt.Fprintf(&b, "<a href=\"%s\">%s</a>\n", html.EscapeString(u.String()), html.EscapeString(s))
+	}
+	b.WriteString("</pre>\n")
+	ctx.ContentTypeHTML()
+	ctx.NoCache()
+	ctx.Write(b.Bytes())
+}
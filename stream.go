@@ -0,0 +1,243 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	mimeNDJSON  = "application/x-ndjson"
+	mimeJSONSeq = "application/json-seq"
+	recordSep   = 0x1e
+)
+
+var ErrRecordTooLarge = errors.New("record too large")
+
+type StreamOptions struct {
+	MaxRecordSize int
+	FlushEvery    int           // records
+	FlushInterval time.Duration // since the last flush
+}
+
+var DefaultStreamOptions = &StreamOptions{
+	MaxRecordSize: 1 << 20,
+	FlushEvery:    100,
+	FlushInterval: time.Second,
+}
+
+type JSONStream struct {
+	ctx     *Context
+	o       *StreamOptions
+	seq     bool
+	n       int
+	flushed time.Time
+}
+
+// application/x-ndjson unless application/json-seq is preferred
+func (ctx *Context) StreamJSON() *JSONStream {
+	return ctx.StreamJSONWith(DefaultStreamOptions)
+}
+
+func (ctx *Context) StreamJSONWith(o *StreamOptions) *JSONStream {
+	if o == nil {
+		o = DefaultStreamOptions
+	}
+	ctx.Vary("Accept")
+	s := &JSONStream{ctx: ctx, o: o, flushed: time.Now()}
+	if ctx.Negotiate(mimeNDJSON, mimeJSONSeq) == mimeJSONSeq {
+		s.seq = true
+		ctx.ContentType(mimeJSONSeq)
+	} else {
+		ctx.ContentType(mimeNDJSON)
+	}
+	return s
+}
+
+func (s *JSONStream) Encode(v interface{}) error {
+	if err := s.ctx.Request.Context().Err(); err != nil {
+		return err
+	}
+	p, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	b.Grow(len(p) + 2)
+	if s.seq {
+		b.WriteByte(recordSep)
+	}
+	b.Write(p)
+	b.WriteByte('\n')
+	if _, err = s.ctx.Write(b.Bytes()); err != nil {
+		return err
+	}
+	s.n++
+	if s.o.FlushEvery > 0 && s.n%s.o.FlushEvery == 0 ||
+		s.o.FlushInterval > 0 && time.Since(s.flushed) >= s.o.FlushInterval {
+		s.Flush()
+	}
+	return nil
+}
+
+func (s *JSONStream) Flush() {
+	s.ctx.Flush()
+	s.flushed = time.Now()
+}
+
+// newline delimited, record separated or a top level array, by the content type
+func (ctx *Context) DecodeJSONStream(f func(json.RawMessage) error) error {
+	return ctx.DecodeJSONStreamWith(DefaultStreamOptions, f)
+}
+
+func (ctx *Context) DecodeJSONStreamWith(o *StreamOptions, f func(json.RawMessage) error) error {
+	if o == nil {
+		o = DefaultStreamOptions
+	}
+	r := ctx.Request
+	defer r.Body.Close()
+	t, _, err := mime.ParseMediaType(r.Header.Get(contentType))
+	if err != nil {
+		t = ""
+	}
+	sc := bufio.NewScanner(r.Body)
+	sc.Buffer(make([]byte, 0, 64<<10), o.MaxRecordSize+1)
+	switch t {
+	case mimeNDJSON, "application/jsonl", "application/x-jsonlines":
+		sc.Split(splitLines)
+	case mimeJSONSeq:
+		sc.Split(splitRecords)
+	case mimeJSON:
+		sc.Split(newArraySplit())
+	default:
+		return ctx.unsupportedMediaType(t)
+	}
+	var n int
+	for sc.Scan() {
+		if err := r.Context().Err(); err != nil {
+			return err
+		}
+		p := bytes.TrimSpace(sc.Bytes())
+		if len(p) == 0 {
+			continue
+		}
+		n++
+		if len(p) > o.MaxRecordSize {
+			return &DecodeError{http.StatusRequestEntityTooLarge, "record " + strconv.Itoa(n), ErrRecordTooLarge}
+		}
+		if !json.Valid(p) {
+			return badRequest("record "+strconv.Itoa(n), errors.New("malformed json"))
+		}
+		if err := f(json.RawMessage(p)); err != nil {
+			return err
+		}
+	}
+	switch err := sc.Err(); {
+	case err == bufio.ErrTooLong:
+		return &DecodeError{http.StatusRequestEntityTooLarge, "record " + strconv.Itoa(n+1), ErrRecordTooLarge}
+	case err != nil:
+		return decodeError(err)
+	}
+	return nil
+}
+
+func splitLines(data []byte, atEOF bool) (int, []byte, error) {
+	return splitAt(data, atEOF, '\n')
+}
+
+func splitRecords(data []byte, atEOF bool) (int, []byte, error) {
+	return splitAt(data, atEOF, recordSep)
+}
+
+func splitAt(data []byte, atEOF bool, sep byte) (int, []byte, error) {
+	if i := bytes.IndexByte(data, sep); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+var errMalformedArray = errors.New("malformed json array")
+
+// the elements of a top level array, scanned for the closing bracket or comma at depth zero
+func newArraySplit() bufio.SplitFunc {
+	var started, ended, comma bool
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		i := 0
+		for i < len(data) && isSpace(data[i]) {
+			i++
+		}
+		if ended {
+			if i < len(data) {
+				return 0, nil, badRequest("", ErrTrailingData)
+			}
+			return i, nil, nil
+		}
+		if i == len(data) {
+			if atEOF {
+				return 0, nil, badRequest("", errMalformedArray)
+			}
+			return i, nil, nil
+		}
+		if !started {
+			if data[i] != '[' {
+				return 0, nil, badRequest("", errMalformedArray)
+			}
+			started = true
+			return i + 1, nil, nil
+		}
+		start := i
+		depth, inString, escaped := 0, false, false
+		for ; i < len(data); i++ {
+			c := data[i]
+			switch {
+			case inString:
+				if escaped {
+					escaped = false
+				} else if c == '\\' {
+					escaped = true
+				} else if c == '"' {
+					inString = false
+				}
+			case c == '"':
+				inString = true
+			case c == '[' || c == '{':
+				depth++
+			case c == ']' || c == '}':
+				if depth == 0 {
+					if c != ']' || comma && i == start {
+						return 0, nil, badRequest("", errMalformedArray)
+					}
+					ended = true
+					return i + 1, data[start:i], nil
+				}
+				depth--
+			case c == ',' && depth == 0:
+				if i == start {
+					return 0, nil, badRequest("", errMalformedArray)
+				}
+				comma = true
+				return i + 1, data[start:i], nil
+			}
+		}
+		if atEOF {
+			return 0, nil, badRequest("", errMalformedArray)
+		}
+		return 0, nil, nil
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
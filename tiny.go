@@ -30,6 +30,10 @@ func newHandler(handler interface{}) Handler {
 		})
 	case func(*Context):
 		return HandlerFunc(h)
+	case func(*Context) error:
+		return HandlerFunc(func(ctx *Context) {
+			ctx.Error(h(ctx))
+		})
 	case func(http.ResponseWriter, *http.Request):
 		return HandlerFunc(func(ctx *Context) {
 			h(ctx, ctx.Request)
@@ -48,14 +52,6 @@ func newHandlers(handlers []interface{}) (a []Handler) {
 	return
 }
 
-func copyHandlers(handlers []Handler) (a []Handler) {
-	if len(handlers) > 0 {
-		a = make([]Handler, len(handlers))
-		copy(a, handlers)
-	}
-	return
-}
-
 func (r *Router) Handler() http.Handler {
 	return newTree(r)
 }
@@ -15,6 +15,10 @@ type Tree struct {
 	methods, names map[string]*Node
 	node           *Node
 	pool           sync.Pool
+	onError        ErrorHandler
+	renderer       Renderer
+	formatError    ErrorFormatter
+	errorPages     map[int]Handler
 }
 
 func (t *Tree) naming(name string, n *Node) {
@@ -79,9 +83,10 @@ func (t *Tree) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	n, params := t.match(r.Method, r.URL.Path)
+	defer t.putParams(params)
 	ctx := &Context{ResponseWriter: w, Request: r, Params: params, tree: t, node: n}
+	defer ctx.finish()
 	ctx.call(ctx.index)
-	t.putParams(params)
 }
 
 func newTree(r *Router) *Tree {
@@ -89,21 +94,29 @@ func newTree(r *Router) *Tree {
 		panic("subrouter not allowed")
 	}
 	t := &Tree{
-		methods:  make(map[string]*Node, 10),
-		handlers: copyHandlers(r.handlers),
+		methods:     make(map[string]*Node, 10),
+		onError:     r.onError,
+		renderer:    r.renderer,
+		formatError: r.formatError,
+		errorPages:  r.errorPages,
 	}
+	t.handlers, _ = resolveHandlers(r.handlers, nil, r.skips)
+	globals := r.handlers
 	var i int
 	handlers := make([]Handler, 0, 10)
 	tags := make([]Tag, 0, 10)
+	skips := append(make([]string, 0, 10), r.skips...)
 Loop:
 	for {
 		if r.above != nil && i == 0 {
 			handlers = append(handlers, r.handlers...)
+			skips = append(skips, r.skips...)
 		}
 		for ; i < len(r.routes); i++ {
 			rr := r.routes[i]
 			handlers = append(handlers, rr.handlers...)
 			tags = append(tags, rr.tags...)
+			skips = append(skips, rr.skips...)
 			if rr.below != nil {
 				r = rr.below
 				i = 0
@@ -144,14 +157,23 @@ Loop:
 				}
 			}
 			n.params = params
+			var pattern string
+			for _, t := range tags {
+				pattern += t.String()
+			}
 			if len(n.handlers) > 0 {
-				var s string
-				for _, t := range tags {
-					s += t.String()
-				}
-				panic("duplicate route " + rr.method + " " + s)
+				panic("duplicate route " + rr.method + " " + pattern)
 			} else {
-				n.handlers = copyHandlers(handlers)
+				n.method = rr.method
+				n.pattern = pattern
+				n.tags = append([]Tag(nil), tags...)
+				n.name = rr.Name
+				n.meta = rr.meta
+				n.onError = r.errorHandler()
+				if a, changed := resolveHandlers(globals, n, skips); changed {
+					n.globals = a
+				}
+				n.handlers, _ = resolveHandlers(handlers, n, skips)
 			}
 			if len(n.params) > 0 {
 				if t.node == nil || len(n.params) > len(t.node.params) {
@@ -161,11 +183,13 @@ Loop:
 			t.naming(rr.Name, n)
 			handlers = handlers[:len(handlers)-len(rr.handlers)]
 			tags = tags[:len(tags)-len(rr.tags)]
+			skips = skips[:len(skips)-len(rr.skips)]
 		}
 		if r.above != nil {
 			i = r.above.index
 			handlers = handlers[:len(handlers)-len(r.handlers)-len(r.above.handlers)]
 			tags = tags[:len(tags)-len(r.above.tags)]
+			skips = skips[:len(skips)-len(r.skips)-len(r.above.skips)]
 			r = r.above.above
 		} else {
 			break
@@ -182,6 +206,13 @@ type Node struct {
 	index        int
 	handlers     []Handler
 	params       []string
+	globals      []Handler
+	onError      ErrorHandler
+	method       string
+	pattern      string
+	tags         []Tag
+	name         string
+	meta         map[string]interface{}
 }
 
 type Static struct {
@@ -0,0 +1,72 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package tiny
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+func buildURL(tags []Tag, params []interface{}) string {
+	var b strings.Builder
+	var n int
+	for _, t := range tags {
+		if t.Kind == 0 {
+			b.WriteString(t.Name)
+			continue
+		}
+		if n >= len(params) {
+			panic("missing url param: " + t.Name)
+		}
+		s := fmt.Sprint(params[n])
+		n++
+		if s == "" && t.Kind != kString || t.Boundary(s) != len(s) {
+			panic("malformed url param " + t.Name + ": " + s)
+		}
+		b.WriteString((&url.URL{Path: s}).EscapedPath())
+	}
+	if n < len(params) {
+		panic("too many url params")
+	}
+	return b.String()
+}
+
+func (r *Router) findTags(name string, tags []Tag) ([]Tag, bool) {
+	for _, rr := range r.routes {
+		a := append(tags[:len(tags):len(tags)], rr.tags...)
+		if rr.below != nil {
+			if a, ok := rr.below.findTags(name, a); ok {
+				return a, true
+			}
+		} else if rr.Name == name {
+			return a, true
+		}
+	}
+	return nil, false
+}
+
+func (r *Router) URL(name string, params ...interface{}) string {
+	for r.above != nil {
+		r = r.above.above
+	}
+	tags, ok := r.findTags(name, nil)
+	if !ok {
+		panic("unknown route name: " + name)
+	}
+	return buildURL(tags, params)
+}
+
+func URL(name string, params ...interface{}) string {
+	return DefaultRouter.URL(name, params...)
+}
+
+func (ctx *Context) URL(name string, params ...interface{}) string {
+	n, ok := ctx.tree.names[name]
+	if !ok {
+		panic("unknown route name: " + name)
+	}
+	return buildURL(n.tags, params)
+}
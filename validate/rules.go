@@ -0,0 +1,340 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+func init() {
+	for name, f := range map[string]Func{
+		"min":      bound(func(i int) bool { return i >= 0 }),
+		"max":      bound(func(i int) bool { return i <= 0 }),
+		"len":      bound(func(i int) bool { return i == 0 }),
+		"eq":       equal,
+		"ne":       notEqual,
+		"gt":       bound(func(i int) bool { return i > 0 }),
+		"gte":      bound(func(i int) bool { return i >= 0 }),
+		"lt":       bound(func(i int) bool { return i < 0 }),
+		"lte":      bound(func(i int) bool { return i <= 0 }),
+		"eqfield":  field2(func(i int) bool { return i == 0 }),
+		"nefield":  field2(func(i int) bool { return i != 0 }),
+		"gtfield":  field2(func(i int) bool { return i > 0 }),
+		"gtefield": field2(func(i int) bool { return i >= 0 }),
+		"ltfield":  field2(func(i int) bool { return i < 0 }),
+		"ltefield": field2(func(i int) bool { return i <= 0 }),
+		"oneof":    oneOf,
+		"email":    email,
+		"url":      isURL,
+		"regexp":   match,
+	} {
+		registry[name] = f
+	}
+}
+
+var messages = map[string]string{
+	"min":      "must be at least %s",
+	"max":      "must be at most %s",
+	"len":      "must be exactly %s",
+	"eq":       "must be equal to %s",
+	"ne":       "must not be equal to %s",
+	"gt":       "must be greater than %s",
+	"gte":      "must be greater than or equal to %s",
+	"lt":       "must be less than %s",
+	"lte":      "must be less than or equal to %s",
+	"eqfield":  "must be equal to %s",
+	"nefield":  "must not be equal to %s",
+	"gtfield":  "must be greater than %s",
+	"gtefield": "must be greater than or equal to %s",
+	"ltfield":  "must be less than %s",
+	"ltefield": "must be less than or equal to %s",
+	"oneof":    "must be one of [%s]",
+	"email":    "must be a valid email address",
+	"url":      "must be a valid URL",
+	"regexp":   "must match %s",
+}
+
+func message(name, param string, v reflect.Value) string {
+	s, ok := messages[name]
+	if !ok {
+		return "failed " + name + " validation"
+	}
+	switch name {
+	case "min", "max", "len":
+		switch v.Kind() {
+		case reflect.String:
+			param += " characters"
+		case reflect.Slice, reflect.Array, reflect.Map:
+			param += " items"
+		}
+	}
+	if strings.Contains(s, "%s") {
+		return fmt.Sprintf(s, param)
+	}
+	return s
+}
+
+func length(v reflect.Value) (int, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(v.String()), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len(), true
+	}
+	return 0, false
+}
+
+// compare v against the textual param, sizes for strings and collections
+func compareParam(v reflect.Value, param string) (int, bool) {
+	if n, ok := length(v); ok {
+		m, err := strconv.Atoi(param)
+		if err != nil {
+			panic("malformed validator param: " + param)
+		}
+		return n - m, true
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == typeDuration {
+			d, err := time.ParseDuration(param)
+			if err != nil {
+				panic("malformed validator param: " + param)
+			}
+			return cmpInt(v.Int(), int64(d)), true
+		}
+		m, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			return cmpFloat(float64(v.Int()), mustFloat(param)), true
+		}
+		return cmpInt(v.Int(), m), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		m, err := strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			return cmpFloat(float64(v.Uint()), mustFloat(param)), true
+		}
+		if v.Uint() < m {
+			return -1, true
+		} else if v.Uint() > m {
+			return 1, true
+		}
+		return 0, true
+	case reflect.Float32, reflect.Float64:
+		return cmpFloat(v.Float(), mustFloat(param)), true
+	case reflect.Bool:
+		b, err := strconv.ParseBool(param)
+		if err != nil {
+			panic("malformed validator param: " + param)
+		}
+		if v.Bool() == b {
+			return 0, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+// panic on params the comparison rules cannot parse for type t
+func checkParam(t reflect.Type, name, param string) {
+	switch name {
+	case "eq", "ne":
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.String {
+			return
+		}
+	case "min", "max", "len", "gt", "gte", "lt", "lte":
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	default:
+		return
+	}
+	compareParam(reflect.Zero(t), param)
+}
+
+func mustFloat(s string) float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		panic("malformed validator param: " + s)
+	}
+	return f
+}
+
+func cmpInt(a, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func cmpFloat(a, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+var typeDuration = reflect.TypeOf(time.Duration(0))
+
+func compareValues(a, b reflect.Value) (int, bool) {
+	for b.Kind() == reflect.Ptr || b.Kind() == reflect.Interface {
+		if b.IsNil() {
+			return 0, false
+		}
+		b = b.Elem()
+	}
+	if a.Type() == typeTime && b.Type() == typeTime {
+		x, y := a.Interface().(time.Time), b.Interface().(time.Time)
+		if x.Before(y) {
+			return -1, true
+		} else if x.After(y) {
+			return 1, true
+		}
+		return 0, true
+	}
+	switch a.Kind() {
+	case reflect.String:
+		if b.Kind() == reflect.String {
+			return strings.Compare(a.String(), b.String()), true
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch b.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return cmpInt(a.Int(), b.Int()), true
+		case reflect.Float32, reflect.Float64:
+			return cmpFloat(float64(a.Int()), b.Float()), true
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		switch b.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return cmpFloat(float64(a.Uint()), float64(b.Uint())), true
+		}
+	case reflect.Float32, reflect.Float64:
+		switch b.Kind() {
+		case reflect.Float32, reflect.Float64:
+			return cmpFloat(a.Float(), b.Float()), true
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return cmpFloat(a.Float(), float64(b.Int())), true
+		}
+	case reflect.Bool:
+		if b.Kind() == reflect.Bool {
+			if a.Bool() == b.Bool() {
+				return 0, true
+			}
+			return 1, true
+		}
+	}
+	if a.Type() == b.Type() && a.Type().Comparable() {
+		if a.Interface() == b.Interface() {
+			return 0, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+func bound(f func(int) bool) Func {
+	return func(v reflect.Value, param string, _ reflect.Value) bool {
+		i, ok := compareParam(v, param)
+		return ok && f(i)
+	}
+}
+
+func equal(v reflect.Value, param string, _ reflect.Value) bool {
+	if v.Kind() == reflect.String {
+		return v.String() == param
+	}
+	i, ok := compareParam(v, param)
+	return ok && i == 0
+}
+
+func notEqual(v reflect.Value, param string, parent reflect.Value) bool {
+	return !equal(v, param, parent)
+}
+
+func field2(f func(int) bool) Func {
+	return func(v reflect.Value, param string, parent reflect.Value) bool {
+		if !parent.IsValid() || parent.Kind() != reflect.Struct {
+			return false
+		}
+		x := parent.FieldByName(param)
+		if !x.IsValid() {
+			panic("unknown field: " + param)
+		}
+		i, ok := compareValues(v, x)
+		return ok && f(i)
+	}
+}
+
+func oneOf(v reflect.Value, param string, _ reflect.Value) bool {
+	var s string
+	switch v.Kind() {
+	case reflect.String:
+		s = v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s = strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s = strconv.FormatUint(v.Uint(), 10)
+	default:
+		return false
+	}
+	for _, i := range strings.Fields(param) {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
+
+func email(v reflect.Value, _ string, _ reflect.Value) bool {
+	if v.Kind() != reflect.String {
+		return false
+	}
+	s := v.String()
+	a, err := mail.ParseAddress(s)
+	return err == nil && a.Address == s && a.Name == ""
+}
+
+func isURL(v reflect.Value, _ string, _ reflect.Value) bool {
+	if v.Kind() != reflect.String {
+		return false
+	}
+	u, err := url.Parse(v.String())
+	return err == nil && u.Scheme != "" && (u.Host != "" || u.Opaque != "")
+}
+
+var (
+	regexps   = make(map[string]*regexp.Regexp, 10)
+	regexpsMu sync.Mutex
+)
+
+func mustCompile(s string) *regexp.Regexp {
+	regexpsMu.Lock()
+	defer regexpsMu.Unlock()
+	r, ok := regexps[s]
+	if !ok {
+		r = regexp.MustCompile(s)
+		regexps[s] = r
+	}
+	return r
+}
+
+func match(v reflect.Value, param string, _ reflect.Value) bool {
+	return v.Kind() == reflect.String && mustCompile(param).MatchString(v.String())
+}
@@ -0,0 +1,278 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package validate
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	TagName  = "validate"
+	NameTag  = "json"
+	mu       sync.RWMutex
+	cache    sync.Map
+	registry = make(map[string]Func, 32)
+	typeTime = reflect.TypeOf(time.Time{})
+)
+
+type Func func(v reflect.Value, param string, parent reflect.Value) bool
+
+func Register(name string, f Func) {
+	if f == nil {
+		panic("nil validator")
+	}
+	switch name {
+	case "", "required", "omitempty":
+		panic("reserved validator name: " + name)
+	}
+	mu.Lock()
+	registry[name] = f
+	mu.Unlock()
+	cache.Range(func(k, _ interface{}) bool {
+		cache.Delete(k)
+		return true
+	})
+}
+
+func lookup(name string) Func {
+	mu.RLock()
+	f := registry[name]
+	mu.RUnlock()
+	return f
+}
+
+type Error struct {
+	Pointer string `json:"pointer" xml:"pointer"`
+	Rule    string `json:"rule" xml:"rule"`
+	Param   string `json:"param,omitempty" xml:"param,omitempty"`
+	Message string `json:"message" xml:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Pointer == "" {
+		return e.Message
+	}
+	return e.Pointer + ": " + e.Message
+}
+
+type Errors []*Error
+
+func (a Errors) Error() string {
+	s := make([]string, len(a))
+	for i, e := range a {
+		s[i] = e.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+func (a Errors) Unwrap() []error {
+	errs := make([]error, len(a))
+	for i, e := range a {
+		errs[i] = e
+	}
+	return errs
+}
+
+func (a Errors) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+type rule struct {
+	name, param string
+	f           Func
+}
+
+type field struct {
+	index               []int
+	name                string
+	required, omitempty bool
+	rules               []rule
+}
+
+func Struct(v interface{}) error {
+	var a Errors
+	value(reflect.ValueOf(v), "", &a)
+	if len(a) > 0 {
+		return a
+	}
+	return nil
+}
+
+func Var(v interface{}, tag string) error {
+	var a Errors
+	rv := reflect.ValueOf(v)
+	f := parseTag(tag, reflect.TypeOf(v))
+	if check(f, rv, "", reflect.Value{}, &a) {
+		value(rv, "", &a)
+	}
+	if len(a) > 0 {
+		return a
+	}
+	return nil
+}
+
+func value(v reflect.Value, ptr string, a *Errors) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == typeTime {
+			return
+		}
+		for _, f := range fields(v.Type()) {
+			fv := v.FieldByIndex(f.index)
+			p := ptr + "/" + escape(f.name)
+			if check(f, fv, p, v, a) {
+				value(fv, p, a)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			value(v.Index(i), ptr+"/"+strconv.Itoa(i), a)
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String {
+			for _, k := range v.MapKeys() {
+				value(v.MapIndex(k), ptr+"/"+escape(k.String()), a)
+			}
+		}
+	}
+}
+
+func check(f *field, v reflect.Value, ptr string, parent reflect.Value, a *Errors) bool {
+	if isZero(v) {
+		if f.required {
+			*a = append(*a, &Error{ptr, "required", "", "is required"})
+			return false
+		}
+		if f.omitempty || v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface || !v.IsValid() {
+			return false
+		}
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	for _, r := range f.rules {
+		if !r.f(v, r.param, parent) {
+			*a = append(*a, &Error{ptr, r.name, r.param, message(r.name, r.param, v)})
+		}
+	}
+	return true
+}
+
+func isZero(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+func escape(s string) string {
+	if strings.ContainsAny(s, "~/") {
+		s = strings.Replace(s, "~", "~0", -1)
+		s = strings.Replace(s, "/", "~1", -1)
+	}
+	return s
+}
+
+func fields(t reflect.Type) []*field {
+	if v, ok := cache.Load(t); ok {
+		return v.([]*field)
+	}
+	a := appendFields(nil, t, nil)
+	cache.Store(t, a)
+	return a
+}
+
+func appendFields(a []*field, t reflect.Type, index []int) []*field {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+		idx := make([]int, len(index)+1)
+		copy(idx, index)
+		idx[len(index)] = i
+		name := sf.Tag.Get(NameTag)
+		if j := strings.IndexByte(name, ','); j >= 0 {
+			name = name[:j]
+		}
+		if name == "-" {
+			continue
+		}
+		tag := sf.Tag.Get(TagName)
+		if tag == "-" {
+			continue
+		}
+		if sf.Anonymous && name == "" && tag == "" {
+			if ft := sf.Type; ft.Kind() == reflect.Struct {
+				a = appendFields(a, ft, idx)
+				continue
+			}
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		f := parseTag(tag, sf.Type)
+		f.index = idx
+		f.name = name
+		a = append(a, f)
+	}
+	return a
+}
+
+// t is the type of the validated value, nil if unknown
+func parseTag(tag string, t reflect.Type) *field {
+	f := new(field)
+	for len(tag) > 0 {
+		var s string
+		if strings.HasPrefix(tag, "regexp=") {
+			s, tag = tag, ""
+		} else if i := strings.IndexByte(tag, ','); i >= 0 {
+			s, tag = tag[:i], tag[i+1:]
+		} else {
+			s, tag = tag, ""
+		}
+		var param string
+		if i := strings.IndexByte(s, '='); i >= 0 {
+			s, param = s[:i], s[i+1:]
+		}
+		switch s {
+		case "":
+		case "required":
+			f.required = true
+		case "omitempty":
+			f.omitempty = true
+		default:
+			fn := lookup(s)
+			if fn == nil {
+				panic("unknown validator: " + s)
+			}
+			if s == "regexp" {
+				mustCompile(param)
+			} else if t != nil {
+				checkParam(t, s, param)
+			}
+			f.rules = append(f.rules, rule{s, param, fn})
+		}
+	}
+	return f
+}
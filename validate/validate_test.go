@@ -0,0 +1,138 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type address struct {
+	City string `json:"city" validate:"required"`
+}
+
+type user struct {
+	Name     string        `json:"name" validate:"required,min=2,max=8"`
+	Email    string        `json:"email" validate:"omitempty,email"`
+	Age      int           `json:"age" validate:"gte=18,lt=150"`
+	Role     string        `json:"role" validate:"oneof=admin user"`
+	Password string        `json:"-"`
+	Confirm  string        `json:"confirm" validate:"eqfield=Password"`
+	Tags     []string      `json:"tags" validate:"max=2"`
+	Score    float64       `json:"score" validate:"max=1.5"`
+	TTL      time.Duration `json:"ttl" validate:"omitempty,max=1m"`
+	Code     string        `json:"code" validate:"omitempty,regexp=^[a-z]+$"`
+	Address  *address      `json:"address"`
+	Extra    map[string]*address
+}
+
+func TestStruct(t *testing.T) {
+	v := user{
+		Name:     "ab",
+		Age:      20,
+		Role:     "user",
+		Password: "x",
+		Confirm:  "x",
+		Score:    1.5,
+	}
+	if err := Struct(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	v = user{
+		Name:     "a",
+		Email:    "x",
+		Age:      17,
+		Role:     "root",
+		Password: "x",
+		Confirm:  "y",
+		Tags:     []string{"a", "b", "c"},
+		Score:    2,
+		TTL:      time.Hour,
+		Code:     "A",
+		Address:  &address{},
+		Extra:    map[string]*address{"a/b": {}},
+	}
+	err := Struct(&v)
+	var a Errors
+	if !errors.As(err, &a) {
+		t.Fatalf("got %v", err)
+	}
+	var got []string
+	for _, e := range a {
+		got = append(got, e.Pointer+" "+e.Rule)
+	}
+	want := []string{
+		"/name min",
+		"/email email",
+		"/age gte",
+		"/role oneof",
+		"/confirm eqfield",
+		"/tags max",
+		"/score max",
+		"/ttl max",
+		"/code regexp",
+		"/address/city required",
+		"/Extra/a~1b/city required",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if a[0].Message != "must be at least 2 characters" {
+		t.Errorf("message %q", a[0].Message)
+	}
+	if a.StatusCode() != 422 {
+		t.Errorf("status %d", a.StatusCode())
+	}
+}
+
+func TestVar(t *testing.T) {
+	if err := Var(3, "min=1,max=5"); err != nil {
+		t.Error(err)
+	}
+	if err := Var("", "required"); err == nil || err.Error() != "is required" {
+		t.Errorf("got %v", err)
+	}
+	if err := Var("b", "eq=a"); err == nil {
+		t.Error("eq passed")
+	}
+}
+
+func TestMalformedParam(t *testing.T) {
+	for _, c := range []struct {
+		v   interface{}
+		tag string
+	}{
+		{1, "min=abc"},
+		{"a", "len=x"},
+		{1.0, "lt=y"},
+		{time.Second, "max=1"},
+		{true, "eq=maybe"},
+		{1, "unknown"},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%T %s: no panic", c.v, c.tag)
+				}
+			}()
+			Var(c.v, c.tag)
+		}()
+	}
+
+	type item struct {
+		N *int `validate:"omitempty,min=abc"`
+	}
+	defer func() {
+		if s, _ := recover().(string); !strings.Contains(s, "abc") {
+			t.Errorf("got %q", s)
+		}
+	}()
+	// panics before any value is validated
+	Struct(item{})
+}
@@ -0,0 +1,388 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package xlsx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cxr29/tiny"
+)
+
+const (
+	nsMain = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	nsRel  = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	nsPkg  = "http://schemas.openxmlformats.org/package/2006/relationships"
+)
+
+// cell styles, see styles
+const (
+	styleNone = iota
+	styleBold
+	styleDate
+	styleDateTime
+)
+
+var (
+	ErrClosed      = errors.New("xlsx: writer closed")
+	ErrSheetClosed = errors.New("xlsx: sheet closed by the next sheet or close")
+	ErrSheetName   = errors.New("xlsx: malformed or duplicate sheet name")
+	ErrNoSheet     = errors.New("xlsx: no sheet")
+)
+
+// Bold cells, others are typed by the value
+type Cell struct {
+	Value interface{}
+	Bold  bool
+}
+
+type SheetOptions struct {
+	Widths     []float64 // by column, zero for the default
+	FreezeRows int
+	FreezeCols int
+}
+
+type Writer struct {
+	zw     *zip.Writer
+	names  []string
+	sheet  *Sheet
+	closed bool
+}
+
+type Sheet struct {
+	w   *bufio.Writer
+	row int
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{zw: zip.NewWriter(w)}
+}
+
+// write the workbook as the response, the caller adds the sheets and closes the writer
+func Attach(ctx *tiny.Context, filename string) *Writer {
+	ctx.ContentTypeXLSX()
+	if filename != "" {
+		ctx.ContentDisposition(filename, "")
+	}
+	return NewWriter(ctx)
+}
+
+func validSheetName(s string, names []string) bool {
+	if s == "" || len([]rune(s)) > 31 || strings.ContainsAny(s, `[]:*?/\`) ||
+		s[0] == '\'' || s[len(s)-1] == '\'' {
+		return false
+	}
+	for _, i := range names {
+		if strings.EqualFold(i, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// the previous sheet is finished, rows are streamed to the sheet until the next
+func (w *Writer) AddSheet(name string, o *SheetOptions) (*Sheet, error) {
+	if w.closed {
+		return nil, ErrClosed
+	}
+	if !validSheetName(name, w.names) {
+		return nil, ErrSheetName
+	}
+	if err := w.endSheet(); err != nil {
+		return nil, err
+	}
+	w.names = append(w.names, name)
+	f, err := w.zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(w.names)))
+	if err != nil {
+		return nil, err
+	}
+	s := &Sheet{w: bufio.NewWriter(f)}
+	w.sheet = s
+	s.printf(`%s<worksheet xmlns="%s" xmlns:r="%s">`, xml.Header, nsMain, nsRel)
+	if o != nil {
+		s.writeOptions(o)
+	}
+	s.printf(`<sheetData>`)
+	return s, s.err
+}
+
+func (s *Sheet) printf(format string, a ...interface{}) {
+	if s.err == nil {
+		_, s.err = fmt.Fprintf(s.w, format, a...)
+	}
+}
+
+func (s *Sheet) writeOptions(o *SheetOptions) {
+	if o.FreezeRows > 0 || o.FreezeCols > 0 {
+		pane := "bottomRight"
+		if o.FreezeCols == 0 {
+			pane = "bottomLeft"
+		} else if o.FreezeRows == 0 {
+			pane = "topRight"
+		}
+		s.printf(`<sheetViews><sheetView workbookViewId="0"><pane`)
+		if o.FreezeCols > 0 {
+			s.printf(` xSplit="%d"`, o.FreezeCols)
+		}
+		if o.FreezeRows > 0 {
+			s.printf(` ySplit="%d"`, o.FreezeRows)
+		}
+		s.printf(` topLeftCell="%s%d" activePane="%s" state="frozen"/></sheetView></sheetViews>`,
+			column(o.FreezeCols), o.FreezeRows+1, pane)
+	}
+	var cols bool
+	for i, width := range o.Widths {
+		if width <= 0 {
+			continue
+		}
+		if !cols {
+			s.printf(`<cols>`)
+			cols = true
+		}
+		s.printf(`<col min="%d" max="%d" width="%s" customWidth="1"/>`, i+1, i+1, formatFloat(width))
+	}
+	if cols {
+		s.printf(`</cols>`)
+	}
+}
+
+// zero based index to A, B, ..., Z, AA, ...
+func column(i int) string {
+	var b [8]byte
+	n := len(b)
+	for i++; i > 0; i = (i - 1) / 26 {
+		n--
+		b[n] = byte('A' + (i-1)%26)
+	}
+	return string(b[n:])
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// days since 1899-12-30, the 1900 date system
+func serial(t time.Time) float64 {
+	y, m, d := t.Date()
+	h, mi, sec := t.Clock()
+	days := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Sub(time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)).Hours() / 24
+	return days + (float64(h*3600+mi*60+sec)+float64(t.Nanosecond())/1e9)/86400
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func (s *Sheet) WriteRow(cells ...interface{}) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.row++
+	s.printf(`<row r="%d">`, s.row)
+	for i, v := range cells {
+		s.writeCell(column(i)+strconv.Itoa(s.row), v)
+	}
+	s.printf(`</row>`)
+	return s.err
+}
+
+// a bold row
+func (s *Sheet) WriteHeader(names ...string) error {
+	a := make([]interface{}, len(names))
+	for i, name := range names {
+		a[i] = Cell{name, true}
+	}
+	return s.WriteRow(a...)
+}
+
+func (s *Sheet) writeCell(ref string, v interface{}) {
+	style := styleNone
+	if c, ok := v.(Cell); ok {
+		v = c.Value
+		if c.Bold {
+			style = styleBold
+		}
+	}
+	var typ, value string
+	switch x := v.(type) {
+	case nil:
+		if style == styleNone {
+			return
+		}
+	case string:
+		s.printf(`<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, escape(x))
+		return
+	case bool:
+		typ, value = "b", "0"
+		if x {
+			value = "1"
+		}
+	case time.Time:
+		if x.IsZero() {
+			return
+		}
+		if h, m, sec := x.Clock(); h == 0 && m == 0 && sec == 0 && x.Nanosecond() == 0 {
+			style = styleDate
+		} else {
+			style = styleDateTime
+		}
+		value = formatFloat(serial(x))
+	case int:
+		value = strconv.Itoa(x)
+	case int8, int16, int32, int64:
+		value = fmt.Sprint(x)
+	case uint, uint8, uint16, uint32, uint64:
+		value = fmt.Sprint(x)
+	case float32:
+		value = formatNumber(float64(x))
+	case float64:
+		value = formatNumber(x)
+	case fmt.Stringer:
+		s.writeCell(ref, Cell{x.String(), style == styleBold})
+		return
+	default:
+		s.writeCell(ref, Cell{fmt.Sprint(x), style == styleBold})
+		return
+	}
+	s.printf(`<c r="%s" s="%d"`, ref, style)
+	if typ != "" {
+		s.printf(` t="%s"`, typ)
+	}
+	if value == "" {
+		s.printf(`/>`)
+	} else {
+		s.printf(`><v>%s</v></c>`, value)
+	}
+}
+
+// NaN and infinities have no cell value
+func formatNumber(f float64) string {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return ""
+	}
+	return formatFloat(f)
+}
+
+func (w *Writer) endSheet() error {
+	s := w.sheet
+	if s == nil {
+		return nil
+	}
+	w.sheet = nil
+	s.printf(`</sheetData></worksheet>`)
+	err := s.err
+	if err == nil {
+		err = s.w.Flush()
+	}
+	s.err = ErrSheetClosed
+	return err
+}
+
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+	if len(w.names) == 0 {
+		return ErrNoSheet
+	}
+	if err := w.endSheet(); err != nil {
+		return err
+	}
+	for _, f := range [...]struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"[Content_Types].xml", w.contentTypes},
+		{"_rels/.rels", rels},
+		{"xl/workbook.xml", w.workbook},
+		{"xl/_rels/workbook.xml.rels", w.workbookRels},
+		{"xl/styles.xml", styles},
+	} {
+		zf, err := w.zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if err = f.write(zf); err != nil {
+			return err
+		}
+	}
+	return w.zw.Close()
+}
+
+func (w *Writer) contentTypes(iw io.Writer) error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	for i := range w.names {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+	}
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	b.WriteString(`</Types>`)
+	_, err := io.WriteString(iw, b.String())
+	return err
+}
+
+func rels(w io.Writer) error {
+	_, err := fmt.Fprintf(w, `%s<Relationships xmlns="%s"><Relationship Id="rId1" Type="%s/officeDocument" Target="xl/workbook.xml"/></Relationships>`,
+		xml.Header, nsPkg, nsRel)
+	return err
+}
+
+func (w *Writer) workbook(iw io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, `%s<workbook xmlns="%s" xmlns:r="%s"><sheets>`, xml.Header, nsMain, nsRel)
+	for i, name := range w.names {
+		fmt.Fprintf(&b, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(name), i+1, i+1)
+	}
+	b.WriteString(`</sheets></workbook>`)
+	_, err := io.WriteString(iw, b.String())
+	return err
+}
+
+func (w *Writer) workbookRels(iw io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, `%s<Relationships xmlns="%s">`, xml.Header, nsPkg)
+	for i := range w.names {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="%s/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, nsRel, i+1)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="%s/styles" Target="styles.xml"/>`, len(w.names)+1, nsRel)
+	b.WriteString(`</Relationships>`)
+	_, err := io.WriteString(iw, b.String())
+	return err
+}
+
+// cellXfs in the order of the style constants
+func styles(w io.Writer) error {
+	_, err := fmt.Fprintf(w, `%s<styleSheet xmlns="%s">`+
+		`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>`+
+		`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>`+
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>`+
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>`+
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>`+
+		`<cellXfs count="4">`+
+		`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>`+
+		`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>`+
+		`<xf numFmtId="14" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>`+
+		`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>`+
+		`</cellXfs>`+
+		`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>`+
+		`</styleSheet>`, xml.Header, nsMain)
+	return err
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2016 CHEN Xianren. All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cxr29/tiny"
+)
+
+func readZip(t *testing.T, p []byte) map[string]string {
+	zr, err := zip.NewReader(bytes.NewReader(p), int64(len(p)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		m[f.Name] = string(b)
+	}
+	return m
+}
+
+func TestAttach(t *testing.T) {
+	r := new(tiny.Router)
+	r.GET("/report", func(ctx *tiny.Context) error {
+		w := Attach(ctx, "report.xlsx")
+		s, err := w.AddSheet("Orders", &SheetOptions{Widths: []float64{20, 0, 12}, FreezeRows: 1})
+		if err != nil {
+			return err
+		}
+		s.WriteHeader("Name", "Amount", "Date", "Paid")
+		s.WriteRow("Ann <&>", 12.5, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), true)
+		s.WriteRow("Bob", -3, nil, false, math.NaN(), Cell{Value: 7, Bold: true})
+		s2, err := w.AddSheet("Summary", nil)
+		if err != nil {
+			return err
+		}
+		s2.WriteRow("total", 9.5)
+		if _, err := w.AddSheet("summary", nil); err != ErrSheetName {
+			t.Errorf("duplicate sheet: %v", err)
+		}
+		return w.Close()
+	})
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/report", nil))
+	if w.Code != 200 || w.Header().Get("Content-Type") != "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet" ||
+		!strings.Contains(w.Header().Get("Content-Disposition"), "report.xlsx") {
+		t.Fatalf("%d %v", w.Code, w.Header())
+	}
+	files := readZip(t, w.Body.Bytes())
+	for _, name := range []string{"[Content_Types].xml", "xl/workbook.xml", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml", "xl/styles.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("missing %s", name)
+		}
+	}
+	sheet := files["xl/worksheets/sheet1.xml"]
+	for _, s := range []string{"Ann &lt;&amp;&gt;", "<v>12.5</v>", "<v>45352</v>", `<pane ySplit="1"`} {
+		if !strings.Contains(sheet, s) {
+			t.Errorf("sheet1 lacks %s", s)
+		}
+	}
+	if !strings.Contains(files["xl/workbook.xml"], `name="Summary"`) {
+		t.Error("workbook lacks Summary")
+	}
+}
+
+func TestSheetClosed(t *testing.T) {
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	if err := w.Close(); err != ErrNoSheet {
+		t.Errorf("close without sheets: %v", err)
+	}
+	w = NewWriter(&b)
+	s1, _ := w.AddSheet("a", nil)
+	s1.WriteRow(1)
+	s2, _ := w.AddSheet("b", nil)
+	if err := s1.WriteRow(2); err != ErrSheetClosed {
+		t.Errorf("previous sheet: %v", err)
+	}
+	s2.WriteRow(3)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s2.WriteRow(4); err != ErrSheetClosed {
+		t.Errorf("after close: %v", err)
+	}
+	if _, err := w.AddSheet("c", nil); err != ErrClosed {
+		t.Errorf("add after close: %v", err)
+	}
+}